@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supported --aggregate functions.
+const (
+	aggregateSum = "sum"
+	aggregateMax = "max"
+)
+
+// Supported --sort orders.
+const (
+	sortDesired = "desired"
+	sortName    = "name"
+	sortState   = "state"
+)
+
+// Supported --group_by keys besides "label:KEY".
+const (
+	groupByProject  = "project"
+	groupByLocation = "location"
+)
+
+// groupNone is the group of jobs without the --group_by label.
+const groupNone = "(none)"
+
+// aggregate combines the worker counts of several jobs into single numbers.
+type aggregate struct {
+	Function       string `json:"aggregate"`
+	Group          string `json:"group,omitempty"` // The --group_by value shared by the jobs.
+	Jobs           int    `json:"jobs"`
+	FailedJobs     int    `json:"failed_jobs"`
+	CurrentWorkers int64  `json:"current_workers"`
+	TargetWorkers  int64  `json:"target_workers"`
+	DesiredWorkers int64  `json:"desired_workers"`
+}
+
+func validateAggregate(function string) error {
+	switch function {
+	case "", aggregateSum, aggregateMax:
+		return nil
+	}
+	return fmt.Errorf("--aggregate must be %q or %q, got %q", aggregateSum, aggregateMax, function)
+}
+
+func validateGroupBy(groupBy string) error {
+	switch {
+	case groupBy == "", groupBy == groupByProject, groupBy == groupByLocation:
+		return nil
+	case strings.HasPrefix(groupBy, "label:") && len(groupBy) > len("label:"):
+		return nil
+	}
+	return fmt.Errorf("--group_by must be 'label:KEY', %q or %q, got %q", groupByProject, groupByLocation, groupBy)
+}
+
+func validateSort(sortBy string) error {
+	switch sortBy {
+	case sortDesired, sortName, sortState:
+		return nil
+	}
+	return fmt.Errorf("--sort must be %q, %q or %q, got %q", sortDesired, sortName, sortState, sortBy)
+}
+
+// sortResults orders successful results by sortBy, breaking ties by job name
+// and ID.
+func sortResults(results []jobResult, sortBy string) {
+	sort.SliceStable(results, func(i, k int) bool {
+		a, b := results[i].res, results[k].res
+		switch {
+		case sortBy == sortDesired && a.DesiredWorkers != b.DesiredWorkers:
+			return a.DesiredWorkers > b.DesiredWorkers
+		case sortBy == sortState && a.JobStatus != b.JobStatus:
+			return a.JobStatus < b.JobStatus
+		case a.JobName != b.JobName:
+			return a.JobName < b.JobName
+		}
+		return a.JobID < b.JobID
+	})
+}
+
+// groupOf returns the group of r under groupBy.
+func groupOf(groupBy string, r jobResult) string {
+	switch groupBy {
+	case groupByProject:
+		return r.opts.ProjectID
+	case groupByLocation:
+		return r.opts.Location
+	}
+	if v, ok := r.labels[strings.TrimPrefix(groupBy, "label:")]; ok {
+		return v
+	}
+	return groupNone
+}
+
+// groupAggregates combines the results of each group with function, ordered
+// by group.
+func groupAggregates(function, groupBy string, results []jobResult) []aggregate {
+	groups := map[string][]jobResult{}
+	for _, r := range results {
+		g := groupOf(groupBy, r)
+		groups[g] = append(groups[g], r)
+	}
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+
+	aggregates := make([]aggregate, len(names))
+	for i, g := range names {
+		aggregates[i] = newAggregate(function, groups[g])
+		aggregates[i].Group = g
+	}
+	return aggregates
+}
+
+// newAggregate combines the results of the jobs looked up successfully with
+// function; failed lookups are only counted.
+func newAggregate(function string, results []jobResult) aggregate {
+	a := aggregate{Function: function}
+	for _, r := range results {
+		if r.err != nil {
+			a.FailedJobs++
+			continue
+		}
+		a.Jobs++
+		a.CurrentWorkers = combine(function, a.CurrentWorkers, r.res.CurrentWorkers)
+		a.TargetWorkers = combine(function, a.TargetWorkers, r.res.TargetWorkers)
+		a.DesiredWorkers = combine(function, a.DesiredWorkers, r.res.DesiredWorkers)
+	}
+	return a
+}
+
+func combine(function string, acc, v int64) int64 {
+	if function == aggregateMax {
+		return max(acc, v)
+	}
+	return acc + v
+}
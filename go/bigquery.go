@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cloud.google.com/go/bigquery"
+	"context"
+	"dataflow_worker_count/workercount"
+	"errors"
+	"fmt"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// observationRow is the BigQuery schema of a single observation.
+type observationRow struct {
+	Timestamp      time.Time `bigquery:"timestamp"`
+	ProjectID      string    `bigquery:"project_id"`
+	Location       string    `bigquery:"location"`
+	JobID          string    `bigquery:"job_id"`
+	CurrentWorkers int64     `bigquery:"current_workers"`
+	TargetWorkers  int64     `bigquery:"target_workers"`
+	DesiredWorkers int64     `bigquery:"desired_workers"`
+	State          string    `bigquery:"state"`
+}
+
+// bigQuerySink appends every observation to a BigQuery table, creating a
+// day-partitioned table with the observationRow schema if it does not exist.
+type bigQuerySink struct {
+	client   *bigquery.Client
+	inserter *bigquery.Inserter
+}
+
+// newBigQuerySink opens tableRef, given as "project.dataset.table" or
+// "dataset.table" in defaultProject.
+func newBigQuerySink(ctx context.Context, defaultProject, tableRef string, opts ...option.ClientOption) (*bigQuerySink, error) {
+	parts := strings.Split(tableRef, ".")
+	if len(parts) == 2 {
+		parts = append([]string{defaultProject}, parts...)
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid --bigquery_table %q, expected 'project.dataset.table' or 'dataset.table'", tableRef)
+	}
+
+	client, err := bigquery.NewClient(ctx, parts[0], opts...)
+	if err != nil {
+		return nil, err
+	}
+	table := client.DatasetInProject(parts[0], parts[1]).Table(parts[2])
+	if err := ensureTable(ctx, table); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("preparing BigQuery table %s: %w", tableRef, err)
+	}
+	return &bigQuerySink{client: client, inserter: table.Inserter()}, nil
+}
+
+func ensureTable(ctx context.Context, table *bigquery.Table) error {
+	_, err := table.Metadata(ctx)
+	if !isHTTPStatus(err, http.StatusNotFound) {
+		return err
+	}
+
+	schema, err := bigquery.InferSchema(observationRow{})
+	if err != nil {
+		return err
+	}
+	err = table.Create(ctx, &bigquery.TableMetadata{
+		Schema:           schema,
+		TimePartitioning: &bigquery.TimePartitioning{Field: "timestamp"},
+	})
+	if isHTTPStatus(err, http.StatusConflict) {
+		// Created concurrently by another instance.
+		return nil
+	}
+	return err
+}
+
+func isHTTPStatus(err error, code int) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == code
+}
+
+func (s *bigQuerySink) Send(ctx context.Context, _, cur *workercount.Result) error {
+	row := &observationRow{
+		Timestamp:      time.Now().UTC(),
+		ProjectID:      cur.ProjectID,
+		Location:       cur.Location,
+		JobID:          cur.JobID,
+		CurrentWorkers: cur.CurrentWorkers,
+		TargetWorkers:  cur.TargetWorkers,
+		DesiredWorkers: cur.DesiredWorkers,
+		State:          cur.JobStatus,
+	}
+	if err := s.inserter.Put(ctx, row); err != nil {
+		return fmt.Errorf("inserting into BigQuery: %w", err)
+	}
+	return nil
+}
+
+func (s *bigQuerySink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"flag"
+	"time"
+)
+
+// breakerFlags configure the circuit breaker of the long-running commands,
+// serve and export.
+type breakerFlags struct {
+	failures int
+	cooldown time.Duration
+}
+
+func registerBreakerFlags(fs *flag.FlagSet) *breakerFlags {
+	f := &breakerFlags{}
+	fs.IntVar(&f.failures, "breaker_failures", 5, "Optional: Consecutive failed lookups of a job after which its lookups are skipped for --breaker_cooldown, rather than waiting on a broken backend every time. 0 disables the circuit breaker.")
+	fs.DurationVar(&f.cooldown, "breaker_cooldown", time.Minute, "Optional: How long the lookups of a job are skipped once its circuit opened, before a single lookup probes whether it recovered.")
+	return f
+}
+
+// breaker returns the circuit breaker selected by the flags, nil if disabled,
+// exiting if they are invalid.
+func (f *breakerFlags) breaker() *workercount.Breaker {
+	if f.failures < 0 {
+		exitf(exitUsage, "--breaker_failures (%d) cannot be negative.", f.failures)
+	}
+	if f.cooldown <= 0 {
+		exitf(exitUsage, "--breaker_cooldown (%v) must be positive.", f.cooldown)
+	}
+	if f.failures == 0 {
+		return nil
+	}
+	return workercount.NewBreaker(f.failures, f.cooldown)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// chartWidth is the number of columns of --chart sparklines.
+const chartWidth = 60
+
+// sparkLevels are the characters of a sparkline, lowest first.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// printChart prints sparklines of the current and target workers reported by
+// events from the first event until end, scaled to the highest count. Times
+// are printed in end's location.
+func printChart(w io.Writer, events []workercount.Event, end time.Time) {
+	if len(events) == 0 || !events[0].Time.Before(end) {
+		fmt.Fprintln(w, "Chart: not enough events")
+		return
+	}
+	start := events[0].Time.In(end.Location())
+	var peak int64
+	for _, e := range events {
+		peak = max(peak, e.CurrentWorkers, e.TargetWorkers)
+	}
+
+	fmt.Fprintf(w, "Chart (%s to %s, peak %d workers):\n", start.Format(time.RFC3339), end.Format(time.RFC3339), peak)
+	fmt.Fprintf(w, "  Current %s\n", sparkline(events, start, end, peak, func(e workercount.Event) int64 { return e.CurrentWorkers }))
+	fmt.Fprintf(w, "  Target  %s\n", sparkline(events, start, end, peak, func(e workercount.Event) int64 { return e.TargetWorkers }))
+}
+
+// sparkline renders the worker count returned by value for the events that
+// report one, each holding until the next one. Columns before the first
+// such event are blank.
+func sparkline(events []workercount.Event, start, end time.Time, peak int64, value func(workercount.Event) int64) string {
+	var b strings.Builder
+	step := end.Sub(start) / chartWidth
+	next, current := 0, int64(-1)
+	for col := 0; col < chartWidth; col++ {
+		at := start.Add(step*time.Duration(col) + step/2)
+		for ; next < len(events) && !events[next].Time.After(at); next++ {
+			if v := value(events[next]); v > 0 {
+				current = v
+			}
+		}
+		switch {
+		case current < 0:
+			b.WriteRune(' ')
+		case peak == 0:
+			b.WriteRune(sparkLevels[0])
+		default:
+			b.WriteRune(sparkLevels[int(current*int64(len(sparkLevels)-1)/peak)])
+		}
+	}
+	return b.String()
+}
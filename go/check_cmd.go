@@ -0,0 +1,86 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Nagios plugin exit codes used by the "check" subcommand.
+const (
+	checkOK       = 0
+	checkWarning  = 1
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+var checkStatusNames = map[int]string{
+	checkOK:       "OK",
+	checkWarning:  "WARNING",
+	checkCritical: "CRITICAL",
+	checkUnknown:  "UNKNOWN",
+}
+
+// runCheck implements the "check" subcommand, a Nagios-compatible plugin
+// comparing the desired worker count against thresholds.
+func runCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	jf := registerJobFlags(fs)
+	warnWorkers := fs.Int64("warn_workers", 0, "Optional: Report WARNING when desired workers are at or above this count. Disabled when 0.")
+	critWorkers := fs.Int64("crit_workers", 0, "Optional: Report CRITICAL when desired workers are at or above this count. Disabled when 0.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s check [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Checks a job's desired workers against thresholds, printing a Nagios plugin status line.\n")
+		fmt.Fprint(os.Stderr, "Exits 0 (OK), 1 (WARNING), 2 (CRITICAL, also when no autoscaling events exist or the job is not in --require_state) or 3 (UNKNOWN).\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+
+	jf.validate(fs)
+	jf.requireSingleJob("check")
+
+	ctx, cancel := jf.context()
+	defer cancel()
+	// A client that cannot be created exits with exitAuth, which is
+	// also the UNKNOWN status.
+	client := jf.newClient(ctx)
+	res, err := client.Fetch(ctx, jf.options())
+	client.Close()
+	if errors.Is(err, workercount.ErrNoEvents) || errors.Is(err, workercount.ErrUnexpectedState) {
+		checkExit(checkCritical, err.Error(), "")
+	}
+	if err != nil {
+		checkExit(checkUnknown, err.Error(), "")
+	}
+
+	status := checkOK
+	switch {
+	case *critWorkers > 0 && res.DesiredWorkers >= *critWorkers:
+		status = checkCritical
+	case *warnWorkers > 0 && res.DesiredWorkers >= *warnWorkers:
+		status = checkWarning
+	}
+	perfdata := fmt.Sprintf("desired=%d;%s;%s;0; current=%d;;;0; target=%d;;;0;",
+		res.DesiredWorkers, checkThreshold(*warnWorkers), checkThreshold(*critWorkers), res.CurrentWorkers, res.TargetWorkers)
+	checkExit(status, fmt.Sprintf("desired workers %d (current %d, target %d)", res.DesiredWorkers, res.CurrentWorkers, res.TargetWorkers), perfdata)
+}
+
+func checkThreshold(v int64) string {
+	if v <= 0 {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// checkExit prints a Nagios plugin status line and exits with status.
+func checkExit(status int, message, perfdata string) {
+	line := fmt.Sprintf("DATAFLOW %s - %s", checkStatusNames[status], message)
+	if perfdata != "" {
+		line += " | " + perfdata
+	}
+	fmt.Println(line)
+	os.Exit(status)
+}
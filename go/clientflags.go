@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"flag"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"sync"
+	"time"
+)
+
+// keepAliveInterval is how long the connections of long-running commands may
+// stay idle before they are checked with a ping. It is below the idle timeout
+// of common NAT gateways and load balancers, and above the minimum interval
+// the Google APIs accept.
+const keepAliveInterval = 2 * time.Minute
+
+// clientFlags configure the connection to the Google Cloud APIs of every
+// command creating a Dataflow client.
+type clientFlags struct {
+	credentialsPath string
+	apiEndpoint     string
+	insecure        bool
+	withoutAuth     bool
+	requestTimeout  time.Duration
+	maxRetries      int
+	retryMaxElapsed time.Duration
+	qps             float64
+	burst           int
+	debugGRPC       bool
+
+	// longRunning is set by the commands reusing their client for as long as
+	// they run, like watch, so its connections are kept alive.
+	longRunning bool
+
+	// rateLimit is the --qps option shared by every client of the process,
+	// created once so that they all draw from the same budget.
+	rateLimit     option.ClientOption
+	rateLimitOnce sync.Once
+}
+
+func registerClientFlags(fs *flag.FlagSet) *clientFlags {
+	f := &clientFlags{}
+	fs.StringVar(&f.credentialsPath, "credentials_path", "", "Optional: Path to your service account JSON key file. If not provided, default application credentials will be used.")
+	fs.StringVar(&f.apiEndpoint, "api_endpoint", "", "Optional: 'host:port' of the Dataflow API to connect to instead of the global endpoint, e.g. a regional endpoint like 'us-central1-dataflow.googleapis.com:443' or a Private Service Connect address, as required by VPC Service Controls perimeters. Other APIs, like Cloud Monitoring, keep their default endpoints.")
+	fs.BoolVar(&f.insecure, "insecure", false, "Optional: Connect to --api_endpoint without TLS and without credentials, e.g. to a fake Dataflow API served by the 'fake' command for offline testing. Applies to every API, so options needing other APIs, like --watermark_age, fail.")
+	fs.BoolVar(&f.withoutAuth, "without_authentication", false, "Optional: Send no credentials, e.g. to a local emulator. Implied by --insecure.")
+	fs.DurationVar(&f.requestTimeout, "request_timeout", time.Minute, "Optional: Maximum time each gRPC API call, like fetching the job or a page of its messages, may take before failing, so a hung call does not block forever. The Compute Engine REST calls of --check_quota and --verify_instances are not covered. 0 disables the limit.")
+	fs.IntVar(&f.maxRetries, "max_retries", 3, "Optional: Number of times a gRPC API call failing with a transient error, like UNAVAILABLE, DEADLINE_EXCEEDED or RESOURCE_EXHAUSTED, is retried with exponential backoff. The Compute Engine REST calls of --check_quota and --verify_instances keep their own retries. 0 disables retries.")
+	fs.DurationVar(&f.retryMaxElapsed, "retry_max_elapsed", time.Minute, "Optional: Maximum time spent retrying an API call, from its first attempt. 0 retries until --max_retries is reached.")
+	fs.Float64Var(&f.qps, "qps", 0, "Optional: Maximum number of gRPC API calls per second, shared by all jobs looked up concurrently and the sinks, so large scans stay within the Dataflow API quota. The Compute Engine REST calls of --check_quota and --verify_instances are not limited. Defaults to no limit.")
+	fs.IntVar(&f.burst, "burst", 10, "Optional: Number of API calls that may be made at once above --qps.")
+	fs.BoolVar(&f.debugGRPC, "debug_grpc", false, "Optional: Log every API call to stderr with its method, a summary of the request, the size of the response and its latency, e.g. to diagnose why a job returns no events.")
+	return f
+}
+
+// clientOptions returns the client options selected by the flags, exiting if
+// they are invalid.
+func (f *clientFlags) clientOptions() []option.ClientOption {
+	if f.insecure && f.apiEndpoint == "" {
+		exitf(exitUsage, "--insecure requires --api_endpoint.")
+	}
+	if (f.insecure || f.withoutAuth) && f.credentialsPath != "" {
+		exitf(exitUsage, "--credentials_path cannot be used with --insecure or --without_authentication.")
+	}
+	if f.requestTimeout < 0 {
+		exitf(exitUsage, "--request_timeout (%v) cannot be negative.", f.requestTimeout)
+	}
+	if f.maxRetries < 0 {
+		exitf(exitUsage, "--max_retries (%d) cannot be negative.", f.maxRetries)
+	}
+	if f.retryMaxElapsed < 0 {
+		exitf(exitUsage, "--retry_max_elapsed (%v) cannot be negative.", f.retryMaxElapsed)
+	}
+	if f.qps < 0 {
+		exitf(exitUsage, "--qps (%g) cannot be negative.", f.qps)
+	}
+	if f.qps > 0 && f.burst < 1 {
+		exitf(exitUsage, "--burst (%d) must be at least 1.", f.burst)
+	}
+
+	opts := credentialsOptions(f.credentialsPath)
+	if f.insecure || f.withoutAuth {
+		// Credentials are never sent over a connection without TLS.
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	if f.insecure {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	}
+	// Retries come first so that every attempt waits for --qps and gets its
+	// own timeout, and the rate limit before the timeout so that waiting for
+	// --qps does not count against --request_timeout.
+	if f.maxRetries > 0 {
+		opts = append(opts, workercount.Retry(f.maxRetries, f.retryMaxElapsed))
+	}
+	if f.qps > 0 {
+		f.rateLimitOnce.Do(func() { f.rateLimit = workercount.RateLimit(f.qps, f.burst) })
+		opts = append(opts, f.rateLimit)
+	}
+	if f.requestTimeout > 0 {
+		opts = append(opts, workercount.RequestTimeout(f.requestTimeout))
+	}
+	if f.longRunning {
+		opts = append(opts, workercount.KeepAlive(keepAliveInterval))
+	}
+	// Debug logging comes last so that every attempt is logged with its own
+	// latency, excluding the time waiting for --qps.
+	if f.debugGRPC {
+		opts = append(opts, workercount.DebugLogging())
+	}
+	return opts
+}
+
+// newClient creates the Dataflow client selected by the flags, exiting on
+// failure.
+func (f *clientFlags) newClient(ctx context.Context) *workercount.Client {
+	client, err := workercount.NewClientWithEndpoint(ctx, f.apiEndpoint, f.clientOptions()...)
+	if err != nil {
+		exitf(exitAuth, "Failed to create Dataflow client: %v", err)
+	}
+	return client
+}
+
+// credentialsOptions returns the client options for --credentials_path.
+func credentialsOptions(credentialsPath string) []option.ClientOption {
+	var opts []option.ClientOption
+	if credentialsPath != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsPath))
+	}
+	return opts
+}
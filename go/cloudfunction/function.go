@@ -0,0 +1,17 @@
+// Package cloudfunction is the Cloud Functions entry point of
+// workercount.HTTPHandler, kept apart so the library does not register
+// handlers with the Functions Framework when merely imported.
+package cloudfunction
+
+import (
+	"dataflow_worker_count/workercount"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+)
+
+// FunctionName is the Functions Framework entry point registered for
+// workercount.HTTPHandler.
+const FunctionName = "DataflowWorkerCount"
+
+func init() {
+	functions.HTTP(FunctionName, workercount.HTTPHandler)
+}
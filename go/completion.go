@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// completeCommand is the hidden command the completion scripts call back
+// into with the words typed so far.
+const completeCommand = "__complete"
+
+// jobIDCompletionTimeout bounds the ListJobs call made while completing --job_id.
+const jobIDCompletionTimeout = 5 * time.Second
+
+const bashCompletion = `# bash completion for %[1]s
+_dataflow_worker_count() {
+	local IFS=$'\n'
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	[[ $cur == "=" ]] && cur=""
+	COMPREPLY=($(compgen -W "$(%[1]s %[2]s "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1)" -- "$cur"))
+}
+complete -o default -F _dataflow_worker_count %[1]s
+`
+
+const zshCompletion = `#compdef %[1]s
+# zsh completion for %[1]s, reusing the bash completion function.
+autoload -U +X bashcompinit && bashcompinit
+` + bashCompletion
+
+const fishCompletion = `# fish completion for %[1]s
+function __dataflow_worker_count_complete
+	set -l words (commandline -opc)
+	set -l cur (commandline -ct)
+	%[1]s %[2]s $words[2..-1] "$cur" 2>/dev/null
+end
+complete -c %[1]s -f -a '(__dataflow_worker_count_complete)'
+`
+
+// runCompletion implements the "completion" subcommand.
+func runCompletion(args []string) {
+	if listFlagsAndExit {
+		os.Exit(0)
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s completion bash|zsh|fish\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Prints a shell completion script, e.g.:\n\n")
+		fmt.Fprintf(os.Stderr, "  source <(%s completion bash)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s completion fish > ~/.config/fish/completions/%s.fish\n", os.Args[0], filepath.Base(os.Args[0]))
+		os.Exit(exitUsage)
+	}
+
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		exitf(exitUsage, "Unsupported shell %q: use bash, zsh or fish.", args[0])
+	}
+	fmt.Printf(script, filepath.Base(os.Args[0]), completeCommand)
+}
+
+// runComplete prints the candidates for the last of words, one per line as
+// "candidate\tdescription". words excludes the program name; the last word
+// is the one being completed and may be empty.
+func runComplete(words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	prev := words[:len(words)-1]
+
+	if len(prev) == 0 && !strings.HasPrefix(cur, "-") {
+		for _, c := range commands {
+			fmt.Printf("%s\t%s\n", c.name, c.summary)
+		}
+		return
+	}
+
+	// Without a command name, flags belong to the default "get" command.
+	name := "get"
+	if len(prev) > 0 && !strings.HasPrefix(prev[0], "-") {
+		name = prev[0]
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		return
+	}
+
+	if flag, partial, ok := completingJobID(prev, cur); ok {
+		completeJobIDs(prev, flag, partial)
+		return
+	}
+	if strings.HasPrefix(cur, "-") {
+		listFlagsAndExit = true
+		cmd.run(nil)
+		return
+	}
+	if len(prev) == 1 && name == prev[0] {
+		for _, s := range cmd.subcommands {
+			fmt.Println(s)
+		}
+	}
+}
+
+// completingJobID reports whether cur is a --job_id value. flag is the prefix
+// to echo back when the shell passed "--job_id=partial" as a single word.
+// bash splits "--job_id=partial" into "--job_id", "=" and "partial".
+func completingJobID(prev []string, cur string) (flag, partial string, ok bool) {
+	for _, f := range []string{"--job_id=", "-job_id="} {
+		if strings.HasPrefix(cur, f) {
+			return f, strings.TrimPrefix(cur, f), true
+		}
+	}
+	n := len(prev)
+	if cur == "=" && n > 0 && isJobIDFlag(prev[n-1]) {
+		return "", "", true
+	}
+	if n > 1 && prev[n-1] == "=" && isJobIDFlag(prev[n-2]) {
+		return "", cur, true
+	}
+	if n > 0 && isJobIDFlag(prev[n-1]) {
+		return "", cur, true
+	}
+	return "", "", false
+}
+
+func isJobIDFlag(w string) bool {
+	return w == "--job_id" || w == "-job_id"
+}
+
+// completeJobIDs lists the active jobs in the project and location typed so
+// far, or the gcloud defaults. Completion stays silent when they are missing
+// or the API call fails.
+func completeJobIDs(words []string, flag, partial string) {
+	projectID := completionFlagValue(words, "project_id")
+	location := completionFlagValue(words, "location")
+	applyGcloudDefaults(&projectID, &location)
+	if projectID == "" || location == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobIDCompletionTimeout)
+	defer cancel()
+	client, err := workercount.NewClient(ctx, credentialsOptions(completionFlagValue(words, "credentials_path"))...)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	jobs, err := client.ListJobs(ctx, projectID, location, workercount.JobFilterActive)
+	if err != nil {
+		return
+	}
+	for _, j := range jobs {
+		if strings.HasPrefix(j.ID, partial) {
+			fmt.Printf("%s%s\t%s\n", flag, j.ID, j.Name)
+		}
+	}
+}
+
+// completionFlagValue returns the value of the named flag in words, accepting
+// "--name=value", "--name value" and bash's split "--name", "=", "value".
+func completionFlagValue(words []string, name string) string {
+	var value string
+	for i, w := range words {
+		w = strings.TrimLeft(w, "-")
+		if len(w) == len(words[i]) {
+			continue
+		}
+		if v, ok := strings.CutPrefix(w, name+"="); ok {
+			value = v
+			continue
+		}
+		if w != name || i+1 >= len(words) {
+			continue
+		}
+		if words[i+1] == "=" && i+2 < len(words) {
+			value = words[i+2]
+		} else if words[i+1] != "=" {
+			value = words[i+1]
+		}
+	}
+	return value
+}
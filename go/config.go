@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configFlag is the flag every command accepts to read flag values from a file.
+const configFlag = "config"
+
+// profileFlag selects a named profile in the config file.
+const profileFlag = "profile"
+
+// profilesKey is the config file key holding the named profiles.
+const profilesKey = "profiles"
+
+// loadConfig reads a config file mapping flag names to values. Files with a
+// .toml extension are read as TOML, anything else as YAML.
+func loadConfig(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// selectProfile returns the config values with the named profile's values
+// layered over the file's top-level ones. An empty name selects the profile
+// named by the file's own "profile" key, if any.
+func selectProfile(values map[string]any, name string) (map[string]any, error) {
+	profiles, _ := values[profilesKey].(map[string]any)
+	if name == "" {
+		name, _ = values[profileFlag].(string)
+	}
+	merged := map[string]any{}
+	for k, v := range values {
+		if k != profilesKey && k != profileFlag {
+			merged[k] = v
+		}
+	}
+	if name == "" {
+		return merged, nil
+	}
+
+	profile, ok := profiles[name].(map[string]any)
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(names, ", "))
+	}
+	for k, v := range profile {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// applyConfig sets the flags of fs that were not already set, on the command
+// line or through the environment, from values. Keys naming flags the command
+// does not have are ignored, so a single file can serve every command. List
+// values set a repeatable flag once per element.
+func applyConfig(fs *flag.FlagSet, values map[string]any) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		var elems []any
+		switch v := values[name].(type) {
+		case []any:
+			elems = v
+		case map[string]any:
+			return fmt.Errorf("%s: expected a value or a list, got a mapping", name)
+		default:
+			elems = []any{v}
+		}
+		for _, e := range elems {
+			if err := fs.Set(name, fmt.Sprint(e)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
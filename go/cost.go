@@ -0,0 +1,25 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"os"
+)
+
+// readPricesFile reads the JSON prices at path. Prices it leaves out keep
+// their workercount.DefaultPrices value.
+func readPricesFile(path string) (*workercount.Prices, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prices := workercount.DefaultPrices
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&prices); err != nil {
+		return nil, err
+	}
+	return &prices, nil
+}
@@ -3,214 +3,169 @@
 //
 // Example usage:
 //
-//	go run dataflow_worker_count.go --project_id="my-project" --location="us-central1" --job_id="my-job" --time_delta_minutes=0 --min_worker=1 --max_worker=1000 --fetch_job_status=true --verbose=true;
+//	go run . get --project_id="my-project" --location="us-central1" --job_id="my-job" --time_delta_minutes=0 --min_worker=1 --max_worker=1000 --fetch_job_status=true --verbose=true;
+//
+// Run without a subcommand, the tool behaves like "get" for backward compatibility.
 package main
 
 import (
-	dataflow "cloud.google.com/go/dataflow/apiv1beta3"
-	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
 	"context"
-	"flag"
+	"dataflow_worker_count/workercount"
+	"errors"
 	"fmt"
-	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
-	"google.golang.org/protobuf/types/known/timestamppb"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
-func main() {
-	projectID := flag.String("project_id", "", "Your Google Cloud project ID. (required)")
-	location := flag.String("location", "", "The regional endpoint where the job is running (e.g., 'us-central1'). (required)")
-	jobID := flag.String("job_id", "", "The ID of the Dataflow job. (required)")
-	timeDeltaMinutes := flag.Int("time_delta_minutes", 0, "Optional: The duration in minutes to look back for events. Defaults to 0 minutes.")
-	credentialsPath := flag.String("credentials_path", "", "Optional: Path to your service account JSON key file. If not provided, default application credentials will be used.")
-	minWorker := flag.Int64("min_worker", 0, "Optional: Minimum number of workers to cap the desired workers.")
-	maxWorker := flag.Int64("max_worker", 0, "Optional: Maximum number of workers to cap the desired workers.")
-	fetchJobStatus := flag.Bool("fetch_job_status", false, "Optional: Fetch the job's current status.")
-	checkTargetWorkers := flag.Bool("check_target_workers", true, "Optional: Whether to consider target workers when determining desired workers, useful if the upscale event has not been actuated yet. Defaults to true.")
-	verbose := flag.Bool("verbose", true, "Optional: If false, only prints the desired worker count. Defaults to true for detailed output.")
-
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		fmt.Fprint(os.Stderr, "Retrieves the latest Dataflow job worker counts within a specified time window.\n\n")
-		flag.PrintDefaults()
-		fmt.Fprintln(os.Stderr, "\nPrerequisites:")
-		fmt.Fprintln(os.Stderr, "  - Authentication: Ensure you are authenticated.")
-		fmt.Fprintln(os.Stderr, "    e.g., 'gcloud auth application-default login' or set GOOGLE_APPLICATION_CREDENTIALS.")
-	}
-	flag.Parse()
-
-	if *projectID == "" || *location == "" || *jobID == "" {
-		log.Println("Error: --project_id, --location, and --job_id are required.")
-		flag.Usage()
-		os.Exit(1)
-	}
-	if *minWorker > 0 && *maxWorker > 0 && *minWorker > *maxWorker {
-		log.Fatalf("--min_worker (%d) cannot be greater than --max_worker (%d).", *minWorker, *maxWorker)
-	}
-	if *minWorker < 0 {
-		log.Fatalf("--min_worker (%d) cannot be negative.", *minWorker)
-	}
-	if *maxWorker < 0 {
-		log.Fatalf("--max_worker (%d) cannot be negative.", *maxWorker)
-	}
-	if *timeDeltaMinutes < 0 {
-		log.Fatalf("--time_delta_minutes (%d) cannot be negative.", *timeDeltaMinutes)
-	}
-
-	ctx := context.Background()
-	var opts []option.ClientOption
-	if *credentialsPath != "" {
-		opts = append(opts, option.WithCredentialsFile(*credentialsPath))
-	}
-
-	jobsClient, err := dataflow.NewJobsV1Beta3Client(ctx, opts...)
-	if err != nil {
-		log.Fatalf("Failed to create Dataflow Jobs client: %v", err)
-	}
-	defer jobsClient.Close()
+// command is a subcommand of the tool.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+	// subcommands are completed as the command's first argument.
+	subcommands []string
+}
 
-	messagesClient, err := dataflow.NewMessagesV1Beta3Client(ctx, opts...)
-	if err != nil {
-		log.Fatalf("Failed to create Dataflow Messages client: %v", err)
+// commands is populated in init to avoid an initialization cycle with usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"get", "Print the latest desired worker count for a job once (default).", runGet, nil},
+		{"watch", "Poll a job at an interval, sending changes to the configured sinks.", runWatch, nil},
+		{"tail", "Follow a job's messages and autoscaling events as they are reported.", runTail, nil},
+		{"serve", "Serve the JSON result over HTTP, like the Cloud Function.", runServe, nil},
+		{"export", "Serve worker counts as Prometheus metrics, fetched on every scrape.", runExport, nil},
+		{"recommend", "Suggest a worker count from a job's backlog growth and throughput.", runRecommend, nil},
+		{"list", "List the Dataflow jobs in a project and location.", runList, nil},
+		{"check", "Nagios-style check of a job's desired workers against thresholds.", runCheck, nil},
+		{"diff", "Compare desired workers with the last observation in a history database.", runDiff, nil},
+		{"history", "Query observations recorded with --history_db.", runHistory, []string{"list", "stats"}},
+		{"terraform", "Act as a Terraform external data source (query JSON on stdin).", runTerraform, nil},
+		{"completion", "Print a bash, zsh or fish completion script.", runCompletion, []string{"bash", "zsh", "fish"}},
+		{"fake", "Serve a fake Dataflow API for offline testing and demos.", runFake, nil},
 	}
-	defer messagesClient.Close()
+}
 
-	jobStatus := "N/A"
-	if *fetchJobStatus {
-		if *verbose {
-			fmt.Println("Fetching job status...")
+func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		name := os.Args[1]
+		if name == "help" {
+			usage()
+			return
 		}
-		req := &dataflowpb.GetJobRequest{
-			ProjectId: *projectID,
-			Location:  *location,
-			JobId:     *jobID,
+		if name == completeCommand {
+			runComplete(os.Args[2:])
+			return
 		}
-		job, err := jobsClient.GetJob(ctx, req)
-		if err != nil {
-			log.Fatalf("API Error fetching job details: %v", err)
+		for _, c := range commands {
+			if c.name == name {
+				c.run(os.Args[2:])
+				return
+			}
 		}
-		jobStatus = dataflowpb.JobState_name[int32(job.GetCurrentState())]
+		log.Printf("Error: unknown command %q.", name)
+		usage()
+		os.Exit(exitUsage)
 	}
-
-	st := time.Now().UTC().Add(-time.Duration(*timeDeltaMinutes) * time.Minute)
-	startTime := timestamppb.New(st)
-
-	if *verbose {
-		fmt.Printf(
-			"Fetching worker counts for job '%s' in project '%s' at location '%s', looking back %d minute(s)...\n",
-			*jobID, *projectID, *location, *timeDeltaMinutes,
-		)
+	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "-help") {
+		usage()
+		return
 	}
+	runGet(os.Args[1:])
+}
 
-	var latestCurrentWorkerEvent, latestTargetWorkerEvent *dataflowpb.AutoscalingEvent
-	var latestCurrentWorkerEventTime, latestTargetWorkerEventTime time.Time
-
-	req := &dataflowpb.ListJobMessagesRequest{
-		ProjectId:         *projectID,
-		Location:          *location,
-		JobId:             *jobID,
-		MinimumImportance: dataflowpb.JobMessageImportance_JOB_MESSAGE_BASIC,
-		StartTime:         startTime,
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n", os.Args[0])
+	fmt.Fprint(os.Stderr, "Retrieves the latest Dataflow job worker counts within a specified time window.\n\n")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> --help' for the flags of a command.\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Every flag can also be set through a %sFLAG_NAME environment variable, e.g. %s.\n", envPrefix, envName("project_id"))
+	printPrerequisites()
+}
 
-	it := messagesClient.ListJobMessages(ctx, req)
-
-	var lastResponse any
-	for {
-		// We call Next() to advance the page.
-		// The individual JobMessage is not used here; we process events from the response page.
-		_, err := it.Next()
-		if err != nil && err != iterator.Done {
-			log.Fatalf("API Error fetching job messages: %v", err)
-		}
-
-		// The iterator's Response field holds the raw response for the current page.
-		if it.Response != nil && it.Response != lastResponse {
-			lastResponse = it.Response
-			resp, ok := it.Response.(*dataflowpb.ListJobMessagesResponse)
-			if !ok {
-				log.Printf("WARN: could not cast response to *dataflowpb.ListJobMessagesResponse")
-				break // Exit loop if response type is unexpected
-			}
-
-			for _, event := range resp.AutoscalingEvents {
-				eventTime := event.GetTime().AsTime()
-				if event.GetCurrentNumWorkers() > 0 && (latestCurrentWorkerEvent == nil || eventTime.After(latestCurrentWorkerEventTime)) {
-					latestCurrentWorkerEvent = event
-					latestCurrentWorkerEventTime = eventTime
-				}
-				if *checkTargetWorkers && event.GetTargetNumWorkers() > 0 && (latestTargetWorkerEvent == nil || eventTime.After(latestTargetWorkerEventTime)) {
-					latestTargetWorkerEvent = event
-					latestTargetWorkerEventTime = eventTime
-				}
-			}
-		}
-
-		if err == iterator.Done {
-			break
-		}
-	} // end of for loop
-
-	var latestCurrentWorkers, latestTargetWorkers, latestDesiredWorkers int64 = 0, 0, 0
-	if latestCurrentWorkerEvent == nil && latestTargetWorkerEvent == nil {
-		log.Fatalf("No autoscaling events with current or target worker counts found in the last %d minute(s).\n", *timeDeltaMinutes)
-	}
+func printPrerequisites() {
+	fmt.Fprintln(os.Stderr, "\nPrerequisites:")
+	fmt.Fprintln(os.Stderr, "  - Authentication: Ensure you are authenticated.")
+	fmt.Fprintln(os.Stderr, "    e.g., 'gcloud auth application-default login' or set GOOGLE_APPLICATION_CREDENTIALS.")
+}
 
-	if latestCurrentWorkerEvent != nil {
-		latestCurrentWorkers = latestCurrentWorkerEvent.GetCurrentNumWorkers()
-	}
+// fetch retrieves the worker counts for opts, announcing what it is about to
+// do through p.
+func fetch(ctx context.Context, client *workercount.Client, opts workercount.Options, p *printer) (*workercount.Result, error) {
+	switch {
+	case opts.WaitForState != "":
+		p.progress("Waiting for the job to reach %s...\n", opts.WaitForState)
+	case opts.FetchJobStatus || opts.ZeroIfTerminal || opts.RequireState != "":
+		p.progress("Fetching job status...\n")
+	}
+	switch {
+	case opts.JobID != "":
+	case opts.JobName != "":
+		p.progress("Looking up the latest active job named '%s'...\n", opts.JobName)
+	default:
+		p.progress("Looking up the latest active job launched from template '%s'...\n", opts.TemplatePath)
+	}
+	p.progress(
+		"Fetching worker counts for job '%s' in project '%s' at location '%s' from events %s...\n",
+		opts.Job(), opts.ProjectID, opts.Location, opts.DescribeWindowIn(p.location()),
+	)
+	if opts.WaitStable {
+		p.progress("Waiting for the current workers to reach the target workers...\n")
+	}
+	return client.Fetch(ctx, opts)
+}
 
-	if *checkTargetWorkers && latestTargetWorkerEvent != nil {
-		latestTargetWorkers = latestTargetWorkerEvent.GetTargetNumWorkers()
+// exitOnFetchError exits with a descriptive message and the exit code for
+// its cause if the lookup failed.
+func exitOnFetchError(err error, opts workercount.Options) {
+	if errors.Is(err, workercount.ErrNoEvents) {
+		exitf(exitNoEvents, "No autoscaling events with current or target worker counts found %s.", opts.DescribeWindow())
 	}
-
-	// `desiredWorkers` is the maximum of the latest current and target worker counts,
-	// clamped by the optional --min_worker and --max_worker flags.
-	var desiredWorkers int64
-	hasDesired := false
-	if latestCurrentWorkerEvent != nil {
-		desiredWorkers = latestCurrentWorkers
-		if latestTargetWorkerEvent != nil && latestTargetWorkers > desiredWorkers {
-			desiredWorkers = latestTargetWorkers
-		}
-		hasDesired = true
-	} else if latestTargetWorkerEvent != nil {
-		desiredWorkers = latestTargetWorkers
-		hasDesired = true
+	if err != nil {
+		exitWithError(err)
 	}
+}
 
-	if hasDesired {
-		if *minWorker > 0 && desiredWorkers < int64(*minWorker) {
-			desiredWorkers = int64(*minWorker)
-		}
-		if *maxWorker > 0 && desiredWorkers > int64(*maxWorker) {
-			desiredWorkers = int64(*maxWorker)
-		}
-		latestDesiredWorkers = desiredWorkers
+// warnIfStale logs a warning if res is based on autoscaling events older
+// than --max_event_age, reporting whether it was.
+func warnIfStale(res *workercount.Result, opts workercount.Options) bool {
+	if !res.Stale {
+		return false
 	}
+	log.Printf("WARN: job %s: the newest autoscaling event, at %s, is older than --max_event_age=%v.", res.JobID, res.LatestEventTime.Format(time.RFC3339), opts.MaxEventAge)
+	return true
+}
 
-	if !*verbose {
-		if hasDesired {
-			fmt.Println(latestDesiredWorkers)
-			return
+// warnIfQuotaInsufficient logs a warning for every quota of res that does
+// not allow the job to reach its maximum number of workers.
+func warnIfQuotaInsufficient(res *workercount.Result) {
+	for _, q := range res.Quotas {
+		if !q.Sufficient {
+			log.Printf("WARN: job %s: %d workers need %g of quota %s in %s, but only %g is available (limit %g, usage %g).", res.JobID, q.MaxWorkers, q.Needed, q.Metric, q.Region, q.Available, q.Limit, q.Usage)
 		}
-		log.Fatalf("Could not determine desired worker count. No autoscaling events with current or target worker counts found in the last %d minute(s).", *timeDeltaMinutes)
 	}
+}
 
-	fmt.Println("\n--- Results ---")
-	if *fetchJobStatus {
-		fmt.Printf("Job Status: %s\n", jobStatus)
+// warnIfInstancesDiverge logs a warning if the running worker instances of
+// res differ from its current workers.
+func warnIfInstancesDiverge(res *workercount.Result) {
+	if res.Instances != nil && res.Instances.Diverged {
+		log.Printf("WARN: job %s: %d worker instances are running, but the events report %d current workers.", res.JobID, res.Instances.Running, res.CurrentWorkers)
 	}
+}
 
-	fmt.Printf("Latest Current Workers: %v\n", latestCurrentWorkers)
-	if *checkTargetWorkers {
-		fmt.Printf("Latest Target Workers: %v\n", latestTargetWorkers)
+// warnIfOverBudget logs a warning if the estimated hourly cost of res
+// exceeds --max_hourly_cost, reporting whether it does.
+func warnIfOverBudget(res *workercount.Result) bool {
+	if !res.OverBudget {
+		return false
 	}
-	fmt.Printf("Min Workers: %d\n", *minWorker)
-	fmt.Printf("Max Workers: %d\n", *maxWorker)
-	fmt.Printf("Latest Desired Workers: %v\n", latestDesiredWorkers)
-	fmt.Println("----------------")
+	log.Printf("WARN: job %s: the estimated cost of %d workers, $%.2f/hour, exceeds --max_hourly_cost=%g.", res.JobID, res.DesiredWorkers, res.Cost.Hourly, res.MaxHourlyCost)
+	return true
 }
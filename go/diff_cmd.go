@@ -0,0 +1,118 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Directions reported by the diff subcommand.
+const (
+	directionUp        = "up"
+	directionDown      = "down"
+	directionUnchanged = "unchanged"
+	directionNew       = "new" // No previous observation was recorded.
+)
+
+// workerDiff compares the current desired workers with the previous observation.
+type workerDiff struct {
+	*workercount.Result
+	PreviousDesiredWorkers *int64     `json:"previous_desired_workers"`
+	PreviousObservedAt     *time.Time `json:"previous_observed_at"`
+	Delta                  int64      `json:"delta"`
+	Direction              string     `json:"direction"`
+}
+
+func newWorkerDiff(prev *observation, cur *workercount.Result) *workerDiff {
+	d := &workerDiff{Result: cur, Direction: directionNew}
+	if prev == nil {
+		return d
+	}
+	d.PreviousDesiredWorkers = &prev.DesiredWorkers
+	d.PreviousObservedAt = &prev.ObservedAt
+	d.Delta = cur.DesiredWorkers - prev.DesiredWorkers
+	switch {
+	case d.Delta > 0:
+		d.Direction = directionUp
+	case d.Delta < 0:
+		d.Direction = directionDown
+	default:
+		d.Direction = directionUnchanged
+	}
+	return d
+}
+
+// runDiff implements the "diff" subcommand: it fetches the job's current
+// desired workers and compares them with the latest observation recorded in
+// the history database, then records the new observation.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jf := registerJobFlags(fs)
+	historyDB := fs.String("history_db", "", "Path to the SQLite history database holding previous observations. (required)")
+	record := fs.Bool("record", true, "Optional: Record the current observation so the next diff compares against it.")
+	exitCode := fs.Bool("exit_code", false, "Optional: Exit with status 1 when the desired worker count changed, like 'git diff --exit-code'.")
+	output := fs.String("output", outputText, "Optional: Output format: 'text' or 'json'.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff --history_db=PATH [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Reports how the desired worker count changed since the previously recorded observation.\n\n")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	jf.validate(fs)
+	jf.requireSingleJob("diff")
+	if *historyDB == "" {
+		log.Println("Error: --history_db is required.")
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if *output != outputText && *output != outputJSON {
+		exitf(exitUsage, "--output must be %q or %q, got %q.", outputText, outputJSON, *output)
+	}
+
+	store, err := openHistoryStore(*historyDB)
+	if err != nil {
+		exitWithError(err)
+	}
+	defer store.Close()
+
+	ctx, cancel := jf.context()
+	defer cancel()
+	client := jf.newClient(ctx)
+	defer client.Close()
+
+	opts := jf.options()
+	res, err := client.Fetch(ctx, opts)
+	exitOnFetchError(err, opts)
+	prev, err := store.Latest(ctx, historyFilter{ProjectID: res.ProjectID, Location: res.Location, JobID: res.JobID})
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if *record {
+		if err := store.Record(ctx, time.Now(), res); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	d := newWorkerDiff(prev, res)
+	if *output == outputJSON {
+		json.NewEncoder(os.Stdout).Encode(d)
+	} else if prev == nil {
+		fmt.Printf("Desired Workers: %d (no previous observation)\n", res.DesiredWorkers)
+	} else {
+		fmt.Printf("Desired Workers: %d (previously %d at %s, %+d, %s)\n",
+			res.DesiredWorkers, prev.DesiredWorkers, prev.ObservedAt.Format(time.RFC3339), d.Delta, d.Direction)
+	}
+
+	if *exitCode && (d.Direction == directionUp || d.Direction == directionDown) {
+		// Close explicitly since os.Exit skips deferred calls.
+		store.Close()
+		client.Close()
+		os.Exit(1)
+	}
+}
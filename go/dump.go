@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// dumpedEvent is a line written by --dump_events.
+type dumpedEvent struct {
+	JobID string `json:"job_id"`
+	workercount.Event
+}
+
+// eventDumpSink appends every autoscaling event considered for a result to
+// a file as JSON lines, for offline analysis.
+type eventDumpSink struct {
+	w io.Writer
+	// f is the file written to, or nil for stdout.
+	f *os.File
+}
+
+func newEventDumpSink(path string) (*eventDumpSink, error) {
+	if path == "-" {
+		return &eventDumpSink{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening --dump_events: %w", err)
+	}
+	return &eventDumpSink{w: f, f: f}, nil
+}
+
+func (s *eventDumpSink) Send(_ context.Context, _, cur *workercount.Result) error {
+	enc := json.NewEncoder(s.w)
+	for _, e := range cur.Events {
+		if err := enc.Encode(dumpedEvent{JobID: cur.JobID, Event: e}); err != nil {
+			return fmt.Errorf("writing --dump_events: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *eventDumpSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
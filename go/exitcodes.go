@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Exit codes of the commands, so scripts can branch on the cause of a
+// failure. The "check" command exits with Nagios plugin codes instead.
+const (
+	// exitFailure is any other failure, e.g. of a sink.
+	exitFailure = 1
+	// exitUsage is an invalid or missing flag.
+	exitUsage = 2
+	// exitAuth is missing credentials or permissions.
+	exitAuth = 3
+	// exitNotFound is a job, or another resource, that does not exist.
+	exitNotFound = 4
+	// exitNoEvents is a job without autoscaling events in the window.
+	exitNoEvents = 5
+	// exitStale is a result older than --max_event_age, by default.
+	exitStale = 6
+	// exitAPI is any other error returned by a Google Cloud API.
+	exitAPI = 7
+	// exitUnexpectedState is a job not in --require_state.
+	exitUnexpectedState = 8
+	// exitOverBudget is an estimated cost above --max_hourly_cost.
+	exitOverBudget = 9
+	// exitDeadline is a run that took longer than --deadline.
+	exitDeadline = 10
+	// exitInterrupted is a run interrupted by SIGINT or SIGTERM, 128 plus
+	// the number of SIGINT like shells report.
+	exitInterrupted = 130
+)
+
+var (
+	// errDeadline is wrapped by the cause of the cancellation of a run that
+	// took longer than --deadline.
+	errDeadline = errors.New("deadline exceeded")
+	// errInterrupted is wrapped by the cause of the cancellation of a run
+	// interrupted by a signal.
+	errInterrupted = errors.New("interrupted")
+)
+
+// runCtx is the context of the run, set by jobFlags.context, so errors after
+// --deadline expired or a signal was received are reported as caused by it.
+var runCtx = context.Background()
+
+// runCancelled returns the cause of the cancellation of the run if --deadline
+// expired or a signal was received, and else nil.
+func runCancelled() error {
+	if cause := context.Cause(runCtx); errors.Is(cause, errDeadline) || errors.Is(cause, errInterrupted) {
+		return cause
+	}
+	return nil
+}
+
+// jsonErrors makes errors be written to stderr as JSON objects rather than
+// log lines. parseFlags sets it for --output=json.
+var jsonErrors bool
+
+// errorOutput is an error as written to stderr with --output=json.
+type errorOutput struct {
+	// Code is the exit code for the cause of the error, even when the
+	// command goes on.
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Job is the job whose lookup failed, if the error is specific to one.
+	Job string `json:"job,omitempty"`
+	// Retryable reports whether the error is transient, so retrying later
+	// may succeed.
+	Retryable bool `json:"retryable"`
+}
+
+// reportError writes an error to stderr, as a JSON object with
+// --output=json and else as a log line.
+func reportError(e errorOutput) {
+	if !jsonErrors {
+		if e.Job != "" {
+			log.Printf("ERROR: job %s: %s", e.Job, e.Message)
+		} else {
+			log.Print(e.Message)
+		}
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Print(e.Message)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", line)
+}
+
+// logError reports err, failing the lookup of job if not empty, without
+// exiting.
+func logError(job string, err error) {
+	message := errorMessage(err)
+	if job == "" && !jsonErrors {
+		message = "ERROR: " + message
+	}
+	reportError(errorOutput{Code: exitCode(err), Message: message, Job: job, Retryable: retryable(err)})
+}
+
+// exitf reports a message formatted like log.Printf and exits with code.
+func exitf(code int, format string, v ...any) {
+	reportError(errorOutput{Code: code, Message: fmt.Sprintf(format, v...)})
+	os.Exit(code)
+}
+
+// exitWithError reports err and exits with the code for its cause.
+func exitWithError(err error) {
+	code := exitCode(err)
+	reportError(errorOutput{Code: code, Message: errorMessage(err), Retryable: retryable(err)})
+	os.Exit(code)
+}
+
+// errorMessage returns the message of err, prefixed with the expiry of
+// --deadline or the signal that caused it.
+func errorMessage(err error) string {
+	if cause := runCancelled(); cause != nil && !errors.Is(err, cause) {
+		return fmt.Sprintf("%v: %v", cause, err)
+	}
+	return err.Error()
+}
+
+// retryable reports whether err is a transient API error, like an
+// unavailable service or exhausted quota.
+func retryable(err error) bool {
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPCode() > 0 {
+		return apiErr.HTTPCode() == http.StatusTooManyRequests || apiErr.HTTPCode() >= http.StatusInternalServerError
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// exitCode returns the exit code for the cause of err.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(runCancelled(), errInterrupted):
+		// Whatever call was cancelled, the signal is the cause.
+		return exitInterrupted
+	case errors.Is(runCancelled(), errDeadline):
+		return exitDeadline
+	case errors.Is(err, workercount.ErrNoEvents):
+		return exitNoEvents
+	case errors.Is(err, workercount.ErrUnexpectedState):
+		return exitUnexpectedState
+	case errors.Is(err, workercount.ErrJobNotFound):
+		return exitNotFound
+	}
+
+	var apiErr *apierror.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPCode() > 0 {
+		// REST APIs, like Compute Engine's, report HTTP status codes.
+		switch apiErr.HTTPCode() {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitAuth
+		case http.StatusNotFound:
+			return exitNotFound
+		}
+		return exitAPI
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return exitFailure
+	}
+	switch s.Code() {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return exitAuth
+	case codes.NotFound:
+		return exitNotFound
+	}
+	return exitAPI
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"errors"
+	"fmt"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+// httpError returns the error of a REST API responding with code.
+func httpError(t *testing.T, code int) error {
+	t.Helper()
+	apiErr, ok := apierror.ParseError(&googleapi.Error{Code: code, Message: "failed"}, true)
+	if !ok {
+		t.Fatalf("parsing an HTTP %d error failed", code)
+	}
+	return fmt.Errorf("calling the API: %w", apiErr)
+}
+
+func TestExitCode(t *testing.T) {
+	_, configErr := selectProfile(map[string]any{profilesKey: map[string]any{"prod": map[string]any{}}}, "staging")
+	if configErr == nil {
+		t.Fatal("selecting a missing profile succeeded")
+	}
+	for _, tc := range []struct {
+		name          string
+		err           error
+		cause         error
+		wantCode      int
+		wantRetryable bool
+	}{
+		{name: "no events", err: fmt.Errorf("job x: %w", workercount.ErrNoEvents), wantCode: exitNoEvents},
+		{name: "unexpected state", err: fmt.Errorf("job x: %w", workercount.ErrUnexpectedState), wantCode: exitUnexpectedState},
+		{name: "job not found", err: fmt.Errorf("job x: %w", workercount.ErrJobNotFound), wantCode: exitNotFound},
+		{name: "unavailable", err: fmt.Errorf("fetching messages: %w", status.Error(codes.Unavailable, "down")), wantCode: exitAPI, wantRetryable: true},
+		{name: "deadline exceeded status", err: fmt.Errorf("fetching messages: %w", status.Error(codes.DeadlineExceeded, "slow")), wantCode: exitAPI, wantRetryable: true},
+		{name: "resource exhausted", err: fmt.Errorf("fetching messages: %w", status.Error(codes.ResourceExhausted, "quota")), wantCode: exitAPI, wantRetryable: true},
+		{name: "invalid argument", err: fmt.Errorf("fetching messages: %w", status.Error(codes.InvalidArgument, "bad")), wantCode: exitAPI},
+		{name: "unauthenticated", err: fmt.Errorf("fetching the job: %w", status.Error(codes.Unauthenticated, "no credentials")), wantCode: exitAuth},
+		{name: "permission denied", err: fmt.Errorf("fetching the job: %w", status.Error(codes.PermissionDenied, "denied")), wantCode: exitAuth},
+		{name: "not found status", err: fmt.Errorf("fetching the job: %w", status.Error(codes.NotFound, "missing")), wantCode: exitNotFound},
+		{name: "http forbidden", err: httpError(t, 403), wantCode: exitAuth},
+		{name: "http not found", err: httpError(t, 404), wantCode: exitNotFound},
+		{name: "http too many requests", err: httpError(t, 429), wantCode: exitAPI, wantRetryable: true},
+		{name: "http unavailable", err: httpError(t, 503), wantCode: exitAPI, wantRetryable: true},
+		{name: "http bad request", err: httpError(t, 400), wantCode: exitAPI},
+		{name: "context deadline exceeded", err: fmt.Errorf("waiting: %w", context.DeadlineExceeded), wantCode: exitFailure},
+		{name: "context canceled", err: fmt.Errorf("waiting: %w", context.Canceled), wantCode: exitFailure},
+		{name: "run deadline", err: status.Error(codes.DeadlineExceeded, "slow"), cause: fmt.Errorf("--deadline: %w", errDeadline), wantCode: exitDeadline, wantRetryable: true},
+		{name: "run interrupted", err: fmt.Errorf("waiting: %w", context.Canceled), cause: fmt.Errorf("SIGTERM: %w", errInterrupted), wantCode: exitInterrupted},
+		{name: "interrupted despite no events", err: workercount.ErrNoEvents, cause: errInterrupted, wantCode: exitInterrupted},
+		{name: "config", err: configErr, wantCode: exitFailure},
+		{name: "other", err: errors.New("writing the output failed"), wantCode: exitFailure},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.cause != nil {
+				ctx, cancel := context.WithCancelCause(context.Background())
+				cancel(tc.cause)
+				runCtx = ctx
+				defer func() { runCtx = context.Background() }()
+			}
+			if got := exitCode(tc.err); got != tc.wantCode {
+				t.Errorf("exitCode(%v) = %d, want %d", tc.err, got, tc.wantCode)
+			}
+			if got := retryable(tc.err); got != tc.wantRetryable {
+				t.Errorf("retryable(%v) = %t, want %t", tc.err, got, tc.wantRetryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"flag"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	jobLabels = []string{"project_id", "location", "job_id", "job_name"}
+
+	currentWorkersDesc = prometheus.NewDesc("dataflow_job_current_workers", "Latest current worker count reported by autoscaling events.", jobLabels, nil)
+	targetWorkersDesc  = prometheus.NewDesc("dataflow_job_target_workers", "Latest target worker count reported by autoscaling events.", jobLabels, nil)
+	desiredWorkersDesc = prometheus.NewDesc("dataflow_job_desired_workers", "Desired worker count after min/max clamping.", jobLabels, nil)
+	watermarkAgeDesc   = prometheus.NewDesc("dataflow_job_data_watermark_age_seconds", "Age of the job's data watermark, with --watermark_age.", jobLabels, nil)
+	scrapeSuccessDesc  = prometheus.NewDesc("dataflow_worker_count_scrape_success", "Whether the last lookup of the job succeeded.", jobLabels, nil)
+	circuitOpenDesc    = prometheus.NewDesc("dataflow_worker_count_circuit_open", "Whether the lookups of the job are skipped after repeated failures, see --breaker_failures.", jobLabels, nil)
+)
+
+// workerCollector is a prometheus.Collector that looks the selected jobs up
+// on every scrape.
+type workerCollector struct {
+	// ctx is the context of the run, so scrapes in flight are cancelled
+	// on shutdown.
+	ctx     context.Context
+	client  *workercount.Client
+	jf      *jobFlags
+	timeout time.Duration
+	// breaker skips the jobs that keep failing; nil if disabled.
+	breaker *workercount.Breaker
+
+	mu sync.Mutex
+	// resolved holds the label values of the last successful lookup of
+	// each job, by breaker key.
+	resolved map[string][]string
+}
+
+// labels returns the label values of the job looked up with opts. A job
+// selected by --job_name or --template_path keeps the ID and name resolved by
+// its last successful lookup while it fails or is skipped.
+func (c *workerCollector) labels(opts workercount.Options) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if labels, ok := c.resolved[workercount.BreakerKey(opts)]; ok {
+		return labels
+	}
+	return []string{opts.ProjectID, opts.Location, opts.JobID, opts.JobName}
+}
+
+// resolve records the label values of the successful lookup of res with
+// opts, returning them.
+func (c *workerCollector) resolve(opts workercount.Options, res *workercount.Result) []string {
+	labels := []string{res.ProjectID, res.Location, res.JobID, res.JobName}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resolved == nil {
+		c.resolved = map[string][]string{}
+	}
+	c.resolved[workercount.BreakerKey(opts)] = labels
+	return labels
+}
+
+// forget drops the label values of the jobs no longer selected.
+func (c *workerCollector) forget(targets []jobTarget) {
+	keep := map[string]bool{}
+	for _, t := range targets {
+		keep[workercount.BreakerKey(t.opts)] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.resolved {
+		if !keep[key] {
+			delete(c.resolved, key)
+		}
+	}
+}
+
+func (c *workerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- currentWorkersDesc
+	ch <- targetWorkersDesc
+	ch <- desiredWorkersDesc
+	ch <- watermarkAgeDesc
+	ch <- scrapeSuccessDesc
+	ch <- circuitOpenDesc
+}
+
+func (c *workerCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+
+	targets, err := c.jf.targets(ctx, c.client)
+	if err != nil {
+		logError("", err)
+		return
+	}
+	c.forget(targets)
+	var allowed []jobTarget
+	for _, t := range targets {
+		if ok, _ := c.breaker.Allow(workercount.BreakerKey(t.opts)); ok {
+			allowed = append(allowed, t)
+			continue
+		}
+		// The job is skipped until its circuit closes.
+		labels := c.labels(t.opts)
+		ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 0, labels...)
+		ch <- prometheus.MustNewConstMetric(circuitOpenDesc, prometheus.GaugeValue, 1, labels...)
+	}
+	for _, r := range fetchTargets(ctx, c.client, allowed, c.jf.concurrency, nil) {
+		if c.breaker.Record(workercount.BreakerKey(r.opts), r.err) {
+			log.Printf("WARN: job %s: circuit opened after repeated failures, skipping its lookups for --breaker_cooldown.", r.opts.Job())
+		}
+		c.collectJob(ch, r)
+	}
+}
+
+func (c *workerCollector) collectJob(ch chan<- prometheus.Metric, r jobResult) {
+	if r.err != nil {
+		logError(r.opts.Job(), r.err)
+		labels := c.labels(r.opts)
+		ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 0, labels...)
+		ch <- prometheus.MustNewConstMetric(circuitOpenDesc, prometheus.GaugeValue, boolGauge(c.breaker.Open(workercount.BreakerKey(r.opts))), labels...)
+		return
+	}
+	res := r.res
+	// With --job_name the job ID is only known once the job was looked up.
+	labels := c.resolve(r.opts, res)
+	ch <- prometheus.MustNewConstMetric(currentWorkersDesc, prometheus.GaugeValue, float64(res.CurrentWorkers), labels...)
+	ch <- prometheus.MustNewConstMetric(targetWorkersDesc, prometheus.GaugeValue, float64(res.TargetWorkers), labels...)
+	ch <- prometheus.MustNewConstMetric(desiredWorkersDesc, prometheus.GaugeValue, float64(res.DesiredWorkers), labels...)
+	if res.WatermarkAgeSeconds != nil {
+		ch <- prometheus.MustNewConstMetric(watermarkAgeDesc, prometheus.GaugeValue, *res.WatermarkAgeSeconds, labels...)
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 1, labels...)
+	ch <- prometheus.MustNewConstMetric(circuitOpenDesc, prometheus.GaugeValue, 0, labels...)
+}
+
+// boolGauge returns the value of a gauge reporting whether b holds.
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// runExport implements the "export" subcommand, a Prometheus exporter.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	jf := registerJobFlags(fs)
+	bf := registerBreakerFlags(fs)
+	listenAddr := fs.String("listen_addr", defaultListenAddr(":9101"), "Optional: Address to serve /metrics on. Defaults to :$PORT when set, otherwise :9101.")
+	scrapeTimeout := fs.Duration("scrape_timeout", 30*time.Second, "Optional: Maximum time spent looking the job up per scrape.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Serves the job's worker counts as Prometheus metrics on /metrics, looked up on every scrape.\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+
+	jf.validate(fs)
+	breaker := bf.breaker()
+	if jf.deadline > 0 {
+		exitf(exitUsage, "--deadline cannot be used with export, which serves until stopped; use --scrape_timeout to bound each scrape.")
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	jf.longRunning = true
+	client := jf.newClient(ctx)
+	defer client.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(&workerCollector{ctx: ctx, client: client, jf: jf, timeout: *scrapeTimeout, breaker: breaker})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	log.Printf("Serving metrics on %s/metrics", *listenAddr)
+	if err := listenAndServe(ctx, *listenAddr, mux); err != nil {
+		exitWithError(err)
+	}
+}
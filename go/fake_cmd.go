@@ -0,0 +1,36 @@
+package main
+
+import (
+	"dataflow_worker_count/fakedataflow"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// runFake implements the "fake" subcommand: a fake Dataflow API serving demo
+// jobs, for offline testing and demos.
+func runFake(args []string) {
+	fs := flag.NewFlagSet("fake", flag.ExitOnError)
+	listenAddr := fs.String("listen_addr", "localhost:8081", "Optional: Address to serve the fake Dataflow API on.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s fake [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Serves a fake Dataflow API over gRPC without TLS, with a running streaming job that scaled up over the last two hours and a finished batch job.\n")
+		fmt.Fprint(os.Stderr, "Point other commands at it with --api_endpoint and --insecure.\n\n")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	server := fakedataflow.NewServer(fakedataflow.DemoJobs(time.Now().UTC())...)
+	addr, shutdown, err := server.Start(*listenAddr)
+	if err != nil {
+		exitWithError(err)
+	}
+	defer shutdown()
+	log.Printf("Serving a fake Dataflow API on %s. Try:", addr)
+	log.Printf("  %s get --api_endpoint=%s --insecure --project_id=%s --location=%s --job_id=%s --lookback=2h", os.Args[0], addr, fakedataflow.DemoProjectID, fakedataflow.DemoLocation, fakedataflow.DemoJobID)
+	<-ctx.Done()
+}
@@ -0,0 +1,260 @@
+// Package fakedataflow is a fake Dataflow API serving fixed jobs, job
+// messages and autoscaling events over gRPC, so integration tests and demos
+// of the tool work without Google Cloud access. Point clients at it with
+// --api_endpoint and --insecure.
+package fakedataflow
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"dataflow_worker_count/workercount"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Job is a job served by a Server along with its messages and autoscaling
+// events.
+type Job struct {
+	*dataflowpb.Job
+	Messages []*dataflowpb.JobMessage
+	Events   []*dataflowpb.AutoscalingEvent
+}
+
+// Server serves the Jobs and Messages services of the Dataflow API for a
+// fixed set of jobs.
+type Server struct {
+	jobs []*Job
+}
+
+// NewServer returns a Server serving jobs.
+func NewServer(jobs ...*Job) *Server {
+	return &Server{jobs: jobs}
+}
+
+// Register registers the services of s with g.
+func (s *Server) Register(g *grpc.Server) {
+	dataflowpb.RegisterJobsV1Beta3Server(g, &jobsServer{s: s})
+	dataflowpb.RegisterMessagesV1Beta3Server(g, &messagesServer{s: s})
+}
+
+// Start serves s on addr, e.g. "localhost:0" for any free port, in the
+// background. It returns the address served and a function stopping the
+// server.
+func (s *Server) Start(addr string) (string, func(), error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	g := grpc.NewServer()
+	s.Register(g)
+	go g.Serve(lis)
+	return lis.Addr().String(), g.GracefulStop, nil
+}
+
+// job returns the job with the given ID in projectID and location, or a
+// NotFound error.
+func (s *Server) job(projectID, location, jobID string) (*Job, error) {
+	for _, j := range s.jobs {
+		if j.Job.GetProjectId() == projectID && j.Job.GetLocation() == location && j.Job.GetId() == jobID {
+			return j, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "job %s not found in project %s at location %s", jobID, projectID, location)
+}
+
+// list returns the jobs in projectID matching filter, in location unless
+// empty.
+func (s *Server) list(projectID, location string, filter dataflowpb.ListJobsRequest_Filter) []*dataflowpb.Job {
+	var jobs []*dataflowpb.Job
+	for _, j := range s.jobs {
+		if j.Job.GetProjectId() != projectID || (location != "" && j.Job.GetLocation() != location) {
+			continue
+		}
+		terminal := workercount.IsTerminalState(j.Job.GetCurrentState().String())
+		if (filter == dataflowpb.ListJobsRequest_ACTIVE && terminal) || (filter == dataflowpb.ListJobsRequest_TERMINATED && !terminal) {
+			continue
+		}
+		jobs = append(jobs, j.Job)
+	}
+	return jobs
+}
+
+type jobsServer struct {
+	dataflowpb.UnimplementedJobsV1Beta3Server
+	s *Server
+}
+
+func (js *jobsServer) GetJob(_ context.Context, req *dataflowpb.GetJobRequest) (*dataflowpb.Job, error) {
+	j, err := js.s.job(req.GetProjectId(), req.GetLocation(), req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	return j.Job, nil
+}
+
+func (js *jobsServer) ListJobs(_ context.Context, req *dataflowpb.ListJobsRequest) (*dataflowpb.ListJobsResponse, error) {
+	return &dataflowpb.ListJobsResponse{Jobs: js.s.list(req.GetProjectId(), req.GetLocation(), req.GetFilter())}, nil
+}
+
+func (js *jobsServer) AggregatedListJobs(_ context.Context, req *dataflowpb.ListJobsRequest) (*dataflowpb.ListJobsResponse, error) {
+	return &dataflowpb.ListJobsResponse{Jobs: js.s.list(req.GetProjectId(), "", req.GetFilter())}, nil
+}
+
+// importanceRank orders the message importances, whose enum values do not:
+// JOB_MESSAGE_BASIC comes after JOB_MESSAGE_ERROR.
+var importanceRank = map[dataflowpb.JobMessageImportance]int{
+	dataflowpb.JobMessageImportance_JOB_MESSAGE_DEBUG:    1,
+	dataflowpb.JobMessageImportance_JOB_MESSAGE_DETAILED: 2,
+	dataflowpb.JobMessageImportance_JOB_MESSAGE_BASIC:    3,
+	dataflowpb.JobMessageImportance_JOB_MESSAGE_WARNING:  4,
+	dataflowpb.JobMessageImportance_JOB_MESSAGE_ERROR:    5,
+}
+
+// DefaultPageSize is the number of messages and events in a page of
+// ListJobMessages when the request does not set one. It is small so that
+// clients page through the demo jobs, some pages holding only events.
+const DefaultPageSize = 3
+
+type messagesServer struct {
+	dataflowpb.UnimplementedMessagesV1Beta3Server
+	s *Server
+}
+
+// pageItem is a message or an autoscaling event listed by ListJobMessages.
+type pageItem struct {
+	time    time.Time
+	message *dataflowpb.JobMessage
+	event   *dataflowpb.AutoscalingEvent
+}
+
+// ListJobMessages returns the messages and events of the job between the
+// start and end time of req, oldest first, in pages of req.PageSize items.
+// The page tokens are the offsets of the pages.
+func (ms *messagesServer) ListJobMessages(_ context.Context, req *dataflowpb.ListJobMessagesRequest) (*dataflowpb.ListJobMessagesResponse, error) {
+	j, err := ms.s.job(req.GetProjectId(), req.GetLocation(), req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	inWindow := func(t *timestamppb.Timestamp) bool {
+		return (req.GetStartTime() == nil || !t.AsTime().Before(req.GetStartTime().AsTime())) &&
+			(req.GetEndTime() == nil || t.AsTime().Before(req.GetEndTime().AsTime()))
+	}
+	var items []pageItem
+	for _, m := range j.Messages {
+		if inWindow(m.GetTime()) && importanceRank[m.GetMessageImportance()] >= importanceRank[req.GetMinimumImportance()] {
+			items = append(items, pageItem{time: m.GetTime().AsTime(), message: m})
+		}
+	}
+	for _, e := range j.Events {
+		if inWindow(e.GetTime()) {
+			items = append(items, pageItem{time: e.GetTime().AsTime(), event: e})
+		}
+	}
+	sort.SliceStable(items, func(i, k int) bool { return items[i].time.Before(items[k].time) })
+
+	offset := 0
+	if req.GetPageToken() != "" {
+		if offset, err = strconv.Atoi(req.GetPageToken()); err != nil || offset < 0 || offset > len(items) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page token %q", req.GetPageToken())
+		}
+	}
+	size := int(req.GetPageSize())
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	end := min(offset+size, len(items))
+	resp := &dataflowpb.ListJobMessagesResponse{}
+	for _, item := range items[offset:end] {
+		if item.message != nil {
+			resp.JobMessages = append(resp.JobMessages, item.message)
+		} else {
+			resp.AutoscalingEvents = append(resp.AutoscalingEvents, item.event)
+		}
+	}
+	if end < len(items) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+// Demo project, location and job served by DemoJobs.
+const (
+	DemoProjectID = "fake-project"
+	DemoLocation  = "us-central1"
+	DemoJobID     = "2024-01-01_00_00_00-1234567890"
+	DemoJobName   = "fake-streaming-job"
+)
+
+// DemoJobs returns a running streaming job, DemoJobID, that scaled from 1 to
+// 3 and then 5 workers over the two hours before now, and a finished batch
+// job.
+func DemoJobs(now time.Time) []*Job {
+	at := func(ago time.Duration) *timestamppb.Timestamp { return timestamppb.New(now.Add(-ago)) }
+	event := func(ago time.Duration, eventType dataflowpb.AutoscalingEvent_AutoscalingEventType, current, target int64, description string) *dataflowpb.AutoscalingEvent {
+		return &dataflowpb.AutoscalingEvent{
+			Time:              at(ago),
+			EventType:         eventType,
+			CurrentNumWorkers: current,
+			TargetNumWorkers:  target,
+			Description:       &dataflowpb.StructuredMessage{MessageText: description},
+			WorkerPool:        "harness",
+		}
+	}
+	message := func(ago time.Duration, importance dataflowpb.JobMessageImportance, text string) *dataflowpb.JobMessage {
+		return &dataflowpb.JobMessage{Id: text, Time: at(ago), MessageText: text, MessageImportance: importance}
+	}
+	streaming := &Job{
+		Job: &dataflowpb.Job{
+			Id:           DemoJobID,
+			ProjectId:    DemoProjectID,
+			Location:     DemoLocation,
+			Name:         DemoJobName,
+			Type:         dataflowpb.JobType_JOB_TYPE_STREAMING,
+			CurrentState: dataflowpb.JobState_JOB_STATE_RUNNING,
+			CreateTime:   at(2 * time.Hour),
+			StartTime:    at(2 * time.Hour),
+			Labels:       map[string]string{"team": "demo"},
+			Environment: &dataflowpb.Environment{
+				WorkerPools: []*dataflowpb.WorkerPool{{
+					Kind:                "harness",
+					NumWorkers:          1,
+					MachineType:         "n1-standard-4",
+					AutoscalingSettings: &dataflowpb.AutoscalingSettings{MaxNumWorkers: 10},
+				}},
+			},
+		},
+		Messages: []*dataflowpb.JobMessage{
+			message(2*time.Hour, dataflowpb.JobMessageImportance_JOB_MESSAGE_BASIC, "Starting 1 workers in us-central1-a..."),
+			message(30*time.Minute, dataflowpb.JobMessageImportance_JOB_MESSAGE_WARNING, "Backlog is growing faster than it is processed."),
+		},
+		Events: []*dataflowpb.AutoscalingEvent{
+			event(115*time.Minute, dataflowpb.AutoscalingEvent_CURRENT_NUM_WORKERS_CHANGED, 1, 0, "Worker pool started with 1 workers."),
+			event(60*time.Minute, dataflowpb.AutoscalingEvent_TARGET_NUM_WORKERS_CHANGED, 0, 3, "Raised the number of workers to 3 based on the backlog."),
+			event(55*time.Minute, dataflowpb.AutoscalingEvent_CURRENT_NUM_WORKERS_CHANGED, 3, 0, "Worker pool resized to 3 workers."),
+			event(20*time.Minute, dataflowpb.AutoscalingEvent_TARGET_NUM_WORKERS_CHANGED, 0, 5, "Raised the number of workers to 5 based on the backlog."),
+			event(15*time.Minute, dataflowpb.AutoscalingEvent_CURRENT_NUM_WORKERS_CHANGED, 5, 0, "Worker pool resized to 5 workers."),
+		},
+	}
+	batch := &Job{
+		Job: &dataflowpb.Job{
+			Id:           "2024-01-01_00_00_00-9876543210",
+			ProjectId:    DemoProjectID,
+			Location:     DemoLocation,
+			Name:         "fake-batch-job",
+			Type:         dataflowpb.JobType_JOB_TYPE_BATCH,
+			CurrentState: dataflowpb.JobState_JOB_STATE_DONE,
+			CreateTime:   at(26 * time.Hour),
+			StartTime:    at(26 * time.Hour),
+		},
+		Events: []*dataflowpb.AutoscalingEvent{
+			event(26*time.Hour, dataflowpb.AutoscalingEvent_CURRENT_NUM_WORKERS_CHANGED, 2, 0, "Worker pool started with 2 workers."),
+		},
+	}
+	return []*Job{streaming, batch}
+}
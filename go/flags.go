@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// timeFlag is a flag.Value holding an RFC 3339 timestamp; the zero value
+// means unset.
+type timeFlag struct{ time.Time }
+
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(v string) error {
+	parsed, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return errors.New("expected an RFC 3339 timestamp like 2024-05-01T00:00:00Z")
+	}
+	t.Time = parsed
+	return nil
+}
+
+// commaList is a stringList that also splits each occurrence on commas.
+type commaList struct{ stringList }
+
+func (l *commaList) Set(v string) error {
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l.stringList = append(l.stringList, e)
+		}
+	}
+	return nil
+}
+
+// listFlagsAndExit makes parseFlags print the command's flags instead of
+// parsing them. Shell completion uses it to discover each command's flags.
+var listFlagsAndExit bool
+
+// envPrefix prefixes the environment variable that can set each flag, e.g.
+// DFWC_PROJECT_ID for --project_id.
+const envPrefix = "DFWC_"
+
+// parseFlags parses a command's flags, then fills the flags not given on the
+// command line from DFWC_* environment variables and after that from the
+// --config file. Every command parses through it.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	configPath := fs.String(configFlag, "", "Optional: YAML or TOML (.toml) file providing flag values by flag name. Flags given on the command line override it.")
+	profile := fs.String(profileFlag, "", "Optional: Named profile under 'profiles' in the --config file, e.g. 'prod'. Its values override the file's top-level values.")
+	if listFlagsAndExit {
+		fs.VisitAll(func(f *flag.Flag) {
+			fmt.Printf("--%s\t%s\n", f.Name, firstSentence(f.Usage))
+		})
+		os.Exit(0)
+	}
+	fs.Parse(args)
+	// --output may also come from the environment or --config.
+	defer func() {
+		if f := fs.Lookup("output"); f != nil && f.Value.String() == outputJSON {
+			jsonErrors = true
+		}
+	}()
+
+	if err := applyEnv(fs); err != nil {
+		exitf(exitUsage, "Invalid environment variable: %v", err)
+	}
+	if *configPath == "" {
+		if *profile != "" {
+			exitf(exitUsage, "--profile requires --config.")
+		}
+		return
+	}
+	values, err := loadConfig(*configPath)
+	if err != nil {
+		exitf(exitUsage, "Failed to load --config: %v", err)
+	}
+	if values, err = selectProfile(values, *profile); err != nil {
+		exitf(exitUsage, "Invalid --profile in --config %s: %v", *configPath, err)
+	}
+	if err := applyConfig(fs, values); err != nil {
+		exitf(exitUsage, "Invalid value in --config %s: %v", *configPath, err)
+	}
+}
+
+// envName returns the environment variable that can set the named flag.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyEnv sets the flags of fs that were not given on the command line from
+// their environment variables.
+func applyEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if set[f.Name] || !ok || err != nil {
+			return
+		}
+		if serr := fs.Set(f.Name, v); serr != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), serr)
+		}
+	})
+	return err
+}
+
+// firstSentence trims a flag's usage to its first sentence for completion descriptions.
+func firstSentence(usage string) string {
+	usage = strings.TrimPrefix(usage, "Optional: ")
+	if i := strings.Index(usage, ". "); i >= 0 {
+		return usage[:i+1]
+	}
+	return usage
+}
+
+// jobFlags are the flags shared by every command that looks up a job's worker counts.
+type jobFlags struct {
+	*clientFlags
+
+	projectID          string
+	location           string
+	jobIDs             commaList
+	jobURL             string
+	jobName            string
+	jobNamePattern     string
+	jobNameGlob        string
+	labels             stringList
+	jobType            string
+	templatePath       string
+	flexTemplate       string
+	jobsFile           string
+	allJobs            bool
+	allLocations       bool
+	projectsFile       string
+	concurrency        int
+	timeDeltaMinutes   int
+	lookback           time.Duration
+	startTime          timeFlag
+	endTime            timeFlag
+	autoExpandLookback bool
+	maxLookback        time.Duration
+	minImportance      string
+	pageSize           int
+	maxEvents          int
+	eventTypes         commaList
+	maxEventAge        time.Duration
+	cooldown           time.Duration
+	stat               string
+	trend              bool
+	rate               bool
+	histogram          bool
+	deadline           time.Duration
+	minWorker          int64
+	maxWorker          int64
+	fetchJobStatus     bool
+	requireState       string
+	waitForState       string
+	waitStable         bool
+	stableTolerance    int64
+	waitTimeout        time.Duration
+	zeroIfTerminal     bool
+	checkTargetWorkers bool
+	ignoreDownscale    bool
+	monitoringFallback bool
+	summarizeMessages  bool
+	withMetrics        bool
+	watermarkAge       bool
+	workerCPU          bool
+	pools              bool
+	pool               string
+	resources          bool
+	estimateCost       bool
+	windowCost         bool
+	maxHourlyCost      float64
+	checkQuota         bool
+	verifyInstances    bool
+	pricesFile         string
+	jobDetails         bool
+	skipFlexRS         bool
+	verticalScaling    bool
+	jobConfigFallback  bool
+
+	// includeEvents lists every event in the results, set by commands whose
+	// output needs them, like --chart or --dump_events.
+	includeEvents bool
+	// prices are the prices read from --prices_file by validate.
+	prices *workercount.Prices
+	// fileTargets are the jobs read from --jobs_file by validate.
+	fileTargets []workercount.Options
+	// projects are the --project_id values or the --projects_file entries,
+	// set by validate.
+	projects []string
+}
+
+func registerJobFlags(fs *flag.FlagSet) *jobFlags {
+	f := &jobFlags{clientFlags: registerClientFlags(fs)}
+	fs.StringVar(&f.projectID, "project_id", "", "Your Google Cloud project ID. Defaults to the gcloud core/project property. Several comma-separated projects may be scanned with --all_jobs, --job_name_pattern, --job_name_glob or --label. (required)")
+	fs.StringVar(&f.location, "location", "", "The regional endpoint where the job is running (e.g., 'us-central1'). Defaults to the gcloud dataflow/region property. Several comma-separated locations may be scanned with --all_jobs, --job_name_pattern, --job_name_glob or --label. (required)")
+	fs.Var(&f.jobIDs, "job_id", "The ID of the Dataflow job. May be repeated or comma-separated to look up several jobs. (required unless another job selector is given)")
+	fs.StringVar(&f.jobURL, "job_url", "", "Optional: Dataflow console URL of the job, as pasted from the UI, e.g. 'https://console.cloud.google.com/dataflow/jobs/us-central1/2024-05-01_01_02_03-123?project=my-project'. Sets --location, --job_id and, if the URL names it, --project_id.")
+	fs.StringVar(&f.jobName, "job_name", "", "Optional: The name of the Dataflow job, resolved to the most recently created active job with that name instead of giving --job_id.")
+	fs.StringVar(&f.jobNamePattern, "job_name_pattern", "", "Optional: Regular expression matched against the whole name of every active job, e.g. 'ingest-.*'. Reports worker counts for each matching job.")
+	fs.StringVar(&f.jobNameGlob, "job_name_glob", "", "Optional: Like --job_name_pattern with a shell-style glob, e.g. 'ingest-*'.")
+	fs.StringVar(&f.jobType, "job_type", "", "Optional: Only select 'batch' or 'streaming' jobs with --all_jobs, --job_name_pattern, --job_name_glob or --label.")
+	fs.StringVar(&f.templatePath, "template_path", "", "Optional: 'gs://' path of a classic template, resolved to the most recently created active job launched from it.")
+	fs.StringVar(&f.flexTemplate, "flex_template", "", "Optional: 'gs://' path of a flex template spec file, resolved to the most recently created active job launched from it.")
+	fs.StringVar(&f.jobsFile, "jobs_file", "", "Optional: File of newline-delimited 'project,location,job_id' lines to look up, or '-' for stdin. Blank lines and lines starting with '#' are ignored. Replaces --project_id and --location.")
+	fs.BoolVar(&f.allJobs, "all_jobs", false, "Optional: Look up every active job in --project_id and --location.")
+	fs.StringVar(&f.projectsFile, "projects_file", "", "Optional: File of newline-delimited project IDs to scan instead of --project_id, or '-' for stdin. Blank lines and lines starting with '#' are ignored.")
+	fs.BoolVar(&f.allLocations, "all_locations", false, "Optional: Scan every location instead of --location, using the aggregated job listing. Requires --all_jobs, --job_name_pattern, --job_name_glob or --label.")
+	fs.Var(&f.labels, "label", "Optional: 'key=value' Dataflow job label that active jobs must carry, e.g. 'team=payments'. May be repeated; jobs must match all of them and any --job_name_pattern or --job_name_glob.")
+	fs.IntVar(&f.concurrency, "concurrency", 8, "Optional: Maximum number of jobs looked up in parallel when several jobs are selected.")
+	fs.IntVar(&f.timeDeltaMinutes, "time_delta_minutes", 0, "Optional: The duration in minutes to look back for events. Defaults to 0 minutes.")
+	fs.DurationVar(&f.lookback, "lookback", 0, "Optional: How far back to look for events as a duration, e.g. '90s' or '2h30m', instead of --time_delta_minutes.")
+	fs.Var(&f.startTime, "start_time", "Optional: RFC 3339 timestamp starting the event window, e.g. '2024-05-01T00:00:00Z', instead of --time_delta_minutes or --lookback.")
+	fs.Var(&f.endTime, "end_time", "Optional: RFC 3339 timestamp ending the event window, e.g. '2024-05-01T12:00:00Z', to investigate past worker counts. Defaults to now.")
+	fs.BoolVar(&f.autoExpandLookback, "auto_expand_lookback", false, "Optional: If no events are found, widen the lookback step by step (5m, 30m, 2h, 24h) up to --max_lookback instead of failing, and report the window the events were found in.")
+	fs.DurationVar(&f.maxLookback, "max_lookback", workercount.DefaultMaxLookback, "Optional: Widest lookback tried by --auto_expand_lookback.")
+	fs.StringVar(&f.minImportance, "min_importance", "basic", "Optional: Minimum importance of the job messages scanned for autoscaling events: 'debug', 'detailed', 'basic', 'warning' or 'error'. Some jobs only report autoscaling context at 'detailed' or 'debug'.")
+	fs.IntVar(&f.pageSize, "page_size", 0, "Optional: Number of job messages requested per page. Larger pages need fewer round trips on very chatty jobs. Defaults to the API's page size.")
+	fs.IntVar(&f.maxEvents, "max_events", 0, "Optional: Stop scanning after this many autoscaling events, bounding the work spent on jobs with enormous message histories. The result is based on the events examined. Defaults to no limit.")
+	fs.Var(&f.eventTypes, "event_types", "Optional: Comma-separated autoscaling event types the result is based on, e.g. 'TARGET_NUM_WORKERS_CHANGED,CURRENT_NUM_WORKERS_CHANGED' to ignore ACTUATION_FAILURE noise. Defaults to every type.")
+	fs.DurationVar(&f.maxEventAge, "max_event_age", 0, "Optional: Warn when the newest autoscaling event the result is based on is older than this, e.g. '15m', so stale counts are not acted on. Defaults to no limit.")
+	fs.DurationVar(&f.cooldown, "cooldown", 0, "Optional: Disregard target worker counts reported less than this before the end of the window, e.g. '2m', as Dataflow may still revise them. Keeps downstream actuators from flapping.")
+	fs.StringVar(&f.stat, "stat", "", "Optional: Also compute a statistic of the worker counts over the whole window: 'avg' for the time-weighted mean of current workers, 'max' for the peak current or target workers, 'min' for the lowest current workers, or a percentile like 'p95' of the time-weighted current workers. Printed instead of the desired workers unless --verbose.")
+	fs.BoolVar(&f.trend, "trend", false, "Optional: Also report whether the worker count is trending 'up', 'down' or 'stable' over the window: a pending target decides, else the slope of the current workers.")
+	fs.BoolVar(&f.rate, "rate", false, "Optional: Also report the workers added per minute over the window, the slope of the current workers, negative when scaling down.")
+	fs.BoolVar(&f.histogram, "histogram", false, "Optional: Also report how long the job ran at each current worker count within the window, e.g. for cost attribution.")
+	fs.DurationVar(&f.deadline, "deadline", 0, "Optional: Maximum time the whole run may take, every API call and page of messages included, e.g. '2m'. The command fails with exit code 10 once it expires; watch and tail stop instead. Defaults to no limit.")
+	fs.Int64Var(&f.minWorker, "min_worker", 0, "Optional: Minimum number of workers to cap the desired workers.")
+	fs.Int64Var(&f.maxWorker, "max_worker", 0, "Optional: Maximum number of workers to cap the desired workers.")
+	fs.BoolVar(&f.fetchJobStatus, "fetch_job_status", false, "Optional: Fetch the job's current status.")
+	fs.StringVar(&f.requireState, "require_state", "", "Optional: Job state such as 'JOB_STATE_RUNNING' the job must be in. The state is checked before any message is scanned, and the lookup fails with a dedicated exit code otherwise.")
+	fs.StringVar(&f.waitForState, "wait_for_state", "", "Optional: Job state such as 'JOB_STATE_RUNNING' to wait for, polling the job, before looking for events. Useful right after launching a pipeline.")
+	fs.BoolVar(&f.waitStable, "wait_stable", false, "Optional: Repeat the lookup until the current workers are within --stable_tolerance of the target workers, then print the stabilized count, e.g. to wait for a scale-up to complete in deployment scripts.")
+	fs.Int64Var(&f.stableTolerance, "stable_tolerance", 0, "Optional: Difference between current and target workers still considered stable by --wait_stable.")
+	fs.DurationVar(&f.waitTimeout, "wait_timeout", 10*time.Minute, "Optional: Maximum time spent waiting for --wait_for_state and --wait_stable. 0 waits indefinitely.")
+	fs.BoolVar(&f.zeroIfTerminal, "zero_if_terminal", false, "Optional: Report 0 workers instead of looking for events if the job is done, failed, cancelled, drained or updated, e.g. when the output feeds an autoscaler.")
+	fs.BoolVar(&f.checkTargetWorkers, "check_target_workers", true, "Optional: Whether to consider target workers when determining desired workers, useful if the upscale event has not been actuated yet. Defaults to true.")
+	fs.BoolVar(&f.summarizeMessages, "summarize_messages", false, "Optional: Also count the error and warning job messages of the window during the same scan and list the most frequent ones, e.g. to see that scaling stalled because of worker startup errors.")
+	fs.BoolVar(&f.watermarkAge, "watermark_age", false, "Optional: Also report how far the data watermark of a streaming job lags behind real time (its freshness), from the dataflow.googleapis.com/job/data_watermark_age metric in Cloud Monitoring.")
+	fs.BoolVar(&f.pools, "pools", false, "Optional: Also report the worker pools configured in the job's environment, e.g. 'harness' and 'shuffle', with their worker counts and machine types.")
+	fs.StringVar(&f.pool, "pool", "", "Optional: Only report the worker pool of this kind, e.g. 'harness', and only count its workers with --job_config_fallback. Implies --pools.")
+	fs.BoolVar(&f.jobDetails, "job_details", false, "Optional: Also report details from the job's full view, like whether it is a FlexRS job and its goal, or runs on Dataflow Prime or Streaming Engine, its type, create and start time, SDK language and version, and runner version, and its autoscaling pipeline options: numWorkers, maxNumWorkers, autoscalingAlgorithm and workerMachineType.")
+	fs.BoolVar(&f.verticalScaling, "vertical_scaling", false, "Optional: Also list the vertical autoscaling and right fitting messages of Dataflow Prime jobs in the window, with the latest memory per worker, as the worker count alone understates Prime capacity changes.")
+	fs.BoolVar(&f.skipFlexRS, "skip_flexrs", false, "Optional: Skip FlexRS jobs when several jobs are selected, as their delayed start skews aggregates.")
+	fs.BoolVar(&f.resources, "resources", false, "Optional: Also report the workers' machine type, of --pool if given, and the total vCPUs, memory and GPUs implied by the desired workers, e.g. 50 x n2-standard-4 = 200 vCPUs / 800 GB, for quota and budget planning.")
+	fs.BoolVar(&f.estimateCost, "estimate_cost", false, "Optional: Also report the approximate hourly cost of the desired workers from their machine type, of --pool if given, using Dataflow's us-central1 vCPU and memory list prices or --prices_file. Disks, Shuffle, Streaming Engine, GPUs and discounts are not included.")
+	fs.BoolVar(&f.windowCost, "window_cost", false, "Optional: Also report the worker hours of the window, integrating the current worker counts over time, and their estimated cost, e.g. what last night's backfill cost. Implies --estimate_cost.")
+	fs.Float64Var(&f.maxHourlyCost, "max_hourly_cost", 0, "Optional: Budget in dollars per hour. Exits with a dedicated code, or notifies --slack_webhook_url in watch mode, when the estimated cost of the desired workers exceeds it. Implies --estimate_cost. Disabled when 0.")
+	fs.StringVar(&f.pricesFile, "prices_file", "", "Optional: JSON file overriding the prices used by --estimate_cost, e.g. '{\"streaming\": {\"vcpu_hour\": 0.08, \"memory_gb_hour\": 0.004}, \"machine_types\": {\"n2-standard-4\": 0.3}}'. Machine type prices are per worker hour.")
+	fs.BoolVar(&f.checkQuota, "check_quota", false, "Optional: Check the CPU and in-use IP address quotas of the job's region, and warn if --max_worker, or the job's maximum number of workers if not given, times the workers' vCPUs is not reachable under the current quota.")
+	fs.BoolVar(&f.verifyInstances, "verify_instances", false, "Optional: Also count the Compute Engine instances of the job's managed instance groups, labeled with its job ID, and warn when the running instances differ from the current workers reported by the events, e.g. zombie or missing workers.")
+	fs.BoolVar(&f.workerCPU, "worker_cpu", false, "Optional: Also report the mean and maximum CPU utilization of the job's worker VMs over the window (at least the last 10 minutes), from Cloud Monitoring, to tell whether the worker count is over- or under-provisioned.")
+	fs.BoolVar(&f.withMetrics, "with_metrics", false, "Optional: Also report the job's system lag, backlog bytes and elements, and element throughput from the Dataflow job metrics, for context on scaling decisions.")
+	fs.BoolVar(&f.monitoringFallback, "monitoring_fallback", false, "Optional: If no autoscaling events are found, report the job's latest dataflow.googleapis.com/job/current_num_workers metric from Cloud Monitoring instead of failing. Tried before --job_config_fallback.")
+	fs.BoolVar(&f.jobConfigFallback, "job_config_fallback", false, "Optional: If no autoscaling events are found, report the number of workers configured in the job's environment instead of failing.")
+	fs.BoolVar(&f.ignoreDownscale, "ignore_downscale", false, "Optional: Disregard a latest target worker count smaller than the latest current worker count, when only scale-ups matter.")
+	return f
+}
+
+// applyJobURL sets --project_id, if the URL names it, --location and --job_id
+// from --job_url, exiting if they conflict with the flags given.
+func (f *jobFlags) applyJobURL() {
+	projectID, location, jobID, err := workercount.ParseJobURL(f.jobURL)
+	if err != nil {
+		exitf(exitUsage, "--job_url: %v.", err)
+	}
+	if len(f.jobIDs.stringList) > 0 {
+		exitf(exitUsage, "--job_url and --job_id are mutually exclusive.")
+	}
+	if f.location != "" && f.location != location {
+		exitf(exitUsage, "--location (%s) conflicts with the location of --job_url (%s).", f.location, location)
+	}
+	if projectID != "" && f.projectID != "" && f.projectID != projectID {
+		exitf(exitUsage, "--project_id (%s) conflicts with the project of --job_url (%s).", f.projectID, projectID)
+	}
+	if projectID != "" {
+		f.projectID = projectID
+	}
+	f.location = location
+	f.jobIDs.stringList = []string{jobID}
+}
+
+// validate exits with a usage error if the flags do not describe a valid lookup.
+func (f *jobFlags) validate(fs *flag.FlagSet) {
+	location := &f.location
+	if f.allLocations {
+		// Every location is scanned, so no default region applies.
+		f.location, location = "", new(string)
+	}
+	if f.projectsFile != "" {
+		projects, err := readProjectsFile(f.projectsFile)
+		if err != nil {
+			exitf(exitUsage, "Failed to read --projects_file: %v", err)
+		}
+		f.projectID = strings.Join(projects, ",")
+	}
+	if f.jobURL != "" {
+		f.applyJobURL()
+	}
+	applyGcloudDefaults(&f.projectID, location)
+	f.projects = splitList(f.projectID)
+	selectors := 0
+	if len(f.jobIDs.stringList) > 0 {
+		selectors++
+	}
+	if f.allJobs {
+		selectors++
+	}
+	for _, v := range []string{f.jobName, f.jobNamePattern, f.jobNameGlob, f.templatePath, f.flexTemplate, f.jobsFile} {
+		if v != "" {
+			selectors++
+		}
+	}
+	if (f.jobsFile == "" && (f.projectID == "" || (f.location == "" && !f.allLocations))) || (selectors == 0 && len(f.labels) == 0) {
+		log.Println("Error: --project_id, --location, and one of --job_id, --job_url, --job_name, --job_name_pattern, --job_name_glob, --label, --template_path, --flex_template or --all_jobs are required, unless --jobs_file is given.")
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if selectors > 1 {
+		exitf(exitUsage, "--job_id or --job_url, --job_name, --job_name_pattern, --job_name_glob, --template_path, --flex_template, --jobs_file and --all_jobs are mutually exclusive.")
+	}
+	if len(f.labels) > 0 && selectors > 0 && f.jobNamePattern == "" && f.jobNameGlob == "" && !f.allJobs {
+		exitf(exitUsage, "--label can only be combined with --job_name_pattern, --job_name_glob or --all_jobs.")
+	}
+	switch f.jobType {
+	case "", jobTypeBatch, jobTypeStreaming:
+	default:
+		exitf(exitUsage, "--job_type must be %q or %q, got %q.", jobTypeBatch, jobTypeStreaming, f.jobType)
+	}
+	if f.jobType != "" && !f.listsJobs() {
+		exitf(exitUsage, "--job_type requires --all_jobs, --job_name_pattern, --job_name_glob or --label.")
+	}
+	if f.skipFlexRS && !f.multiJob() {
+		exitf(exitUsage, "--skip_flexrs requires several jobs to be selected.")
+	}
+	if (f.allLocations || len(f.locations()) > 1 || len(f.projects) > 1) && !f.listsJobs() {
+		exitf(exitUsage, "--all_locations and several --location or --project_id values require --all_jobs, --job_name_pattern, --job_name_glob or --label.")
+	}
+	if f.pricesFile != "" {
+		if !f.estimateCost && !f.windowCost && f.maxHourlyCost == 0 {
+			exitf(exitUsage, "--prices_file requires --estimate_cost, --window_cost or --max_hourly_cost.")
+		}
+		prices, err := readPricesFile(f.pricesFile)
+		if err != nil {
+			exitf(exitUsage, "Failed to read --prices_file: %v", err)
+		}
+		f.prices = prices
+	}
+	if f.jobsFile != "" {
+		targets, err := readJobsFile(f.jobsFile, f.options())
+		if err != nil {
+			exitf(exitUsage, "Failed to read --jobs_file: %v", err)
+		}
+		f.fileTargets = targets
+	} else if f.multiJob() {
+		if _, err := f.jobMatcher(); err != nil {
+			exitf(exitUsage, "%v", err)
+		}
+	}
+	if f.minWorker > 0 && f.maxWorker > 0 && f.minWorker > f.maxWorker {
+		exitf(exitUsage, "--min_worker (%d) cannot be greater than --max_worker (%d).", f.minWorker, f.maxWorker)
+	}
+	if f.minWorker < 0 {
+		exitf(exitUsage, "--min_worker (%d) cannot be negative.", f.minWorker)
+	}
+	if f.maxWorker < 0 {
+		exitf(exitUsage, "--max_worker (%d) cannot be negative.", f.maxWorker)
+	}
+	if f.concurrency < 1 {
+		exitf(exitUsage, "--concurrency (%d) must be at least 1.", f.concurrency)
+	}
+	if f.timeDeltaMinutes < 0 {
+		exitf(exitUsage, "--time_delta_minutes (%d) cannot be negative.", f.timeDeltaMinutes)
+	}
+	if f.lookback < 0 {
+		exitf(exitUsage, "--lookback (%v) cannot be negative.", f.lookback)
+	}
+	if f.lookback > 0 && f.timeDeltaMinutes > 0 {
+		exitf(exitUsage, "--lookback and --time_delta_minutes are mutually exclusive.")
+	}
+	if !f.startTime.IsZero() && (f.timeDeltaMinutes > 0 || f.lookback > 0) {
+		exitf(exitUsage, "--start_time is mutually exclusive with --time_delta_minutes and --lookback.")
+	}
+	if !f.startTime.IsZero() && !f.endTime.IsZero() && !f.startTime.Before(f.endTime.Time) {
+		exitf(exitUsage, "--start_time (%s) must be before --end_time (%s).", &f.startTime, &f.endTime)
+	}
+	if f.maxLookback <= 0 {
+		exitf(exitUsage, "--max_lookback (%v) must be positive.", f.maxLookback)
+	}
+	if f.autoExpandLookback && !f.startTime.IsZero() {
+		exitf(exitUsage, "--auto_expand_lookback cannot be combined with --start_time.")
+	}
+	if _, err := workercount.ParseImportance(f.minImportance); err != nil {
+		exitf(exitUsage, "--%v.", err)
+	}
+	if _, err := workercount.ParseJobState(f.requireState); err != nil {
+		exitf(exitUsage, "--require_state: %v.", err)
+	}
+	if _, err := workercount.ParseJobState(f.waitForState); err != nil {
+		exitf(exitUsage, "--wait_for_state: %v.", err)
+	}
+	if f.maxHourlyCost < 0 {
+		exitf(exitUsage, "--max_hourly_cost (%g) cannot be negative.", f.maxHourlyCost)
+	}
+	if f.deadline < 0 {
+		exitf(exitUsage, "--deadline (%v) cannot be negative.", f.deadline)
+	}
+	if f.stableTolerance < 0 {
+		exitf(exitUsage, "--stable_tolerance (%d) cannot be negative.", f.stableTolerance)
+	}
+	if f.waitTimeout < 0 {
+		exitf(exitUsage, "--wait_timeout (%v) cannot be negative.", f.waitTimeout)
+	}
+	if f.pageSize < 0 {
+		exitf(exitUsage, "--page_size (%d) cannot be negative.", f.pageSize)
+	}
+	if f.maxEvents < 0 {
+		exitf(exitUsage, "--max_events (%d) cannot be negative.", f.maxEvents)
+	}
+	if err := workercount.ValidateStat(f.stat); err != nil {
+		exitf(exitUsage, "--%v.", err)
+	}
+	if f.cooldown < 0 {
+		exitf(exitUsage, "--cooldown (%v) cannot be negative.", f.cooldown)
+	}
+	if f.maxEventAge < 0 {
+		exitf(exitUsage, "--max_event_age (%v) cannot be negative.", f.maxEventAge)
+	}
+	if _, err := workercount.ParseEventTypes(f.eventTypes.stringList); err != nil {
+		exitf(exitUsage, "Invalid --event_types: %v.", err)
+	}
+}
+
+func (f *jobFlags) options() workercount.Options {
+	return workercount.Options{
+		ProjectID:          f.projectID,
+		Location:           f.location,
+		JobID:              f.jobID(),
+		JobName:            f.jobName,
+		TemplatePath:       f.template(),
+		TimeDeltaMinutes:   f.timeDeltaMinutes,
+		Lookback:           f.lookback,
+		StartTime:          f.startTime.Time,
+		EndTime:            f.endTime.Time,
+		AutoExpandLookback: f.autoExpandLookback,
+		MaxLookback:        f.maxLookback,
+		MinImportance:      f.minImportance,
+		PageSize:           int32(f.pageSize),
+		MaxEvents:          f.maxEvents,
+		EventTypes:         f.eventTypes.stringList,
+		MaxEventAge:        f.maxEventAge,
+		Cooldown:           f.cooldown,
+		Stat:               f.stat,
+		Trend:              f.trend,
+		Rate:               f.rate,
+		Histogram:          f.histogram,
+		IncludeEvents:      f.includeEvents,
+		MinWorker:          f.minWorker,
+		MaxWorker:          f.maxWorker,
+		FetchJobStatus:     f.fetchJobStatus,
+		RequireState:       f.requireState,
+		WaitForState:       f.waitForState,
+		WaitStable:         f.waitStable,
+		StableTolerance:    f.stableTolerance,
+		WaitTimeout:        f.waitTimeout,
+		ZeroIfTerminal:     f.zeroIfTerminal,
+		CheckTargetWorkers: f.checkTargetWorkers,
+		IgnoreDownscale:    f.ignoreDownscale,
+		MonitoringFallback: f.monitoringFallback,
+		SummarizeMessages:  f.summarizeMessages,
+		WithMetrics:        f.withMetrics,
+		WatermarkAge:       f.watermarkAge,
+		WorkerCPU:          f.workerCPU,
+		Pools:              f.pools,
+		Pool:               f.pool,
+		Resources:          f.resources,
+		EstimateCost:       f.estimateCost,
+		WindowCost:         f.windowCost,
+		MaxHourlyCost:      f.maxHourlyCost,
+		CheckQuota:         f.checkQuota,
+		VerifyInstances:    f.verifyInstances,
+		Prices:             f.prices,
+		JobDetails:         f.jobDetails,
+		VerticalScaling:    f.verticalScaling,
+		JobConfigFallback:  f.jobConfigFallback,
+	}
+}
+
+// locations returns the comma-separated --location values.
+func (f *jobFlags) locations() []string {
+	return splitList(f.location)
+}
+
+// primaryProject returns the first project scanned. Sinks writing to a
+// project, like --publish_topic or --write_metric, use it.
+func (f *jobFlags) primaryProject() string {
+	if len(f.projects) == 0 {
+		return f.projectID
+	}
+	return f.projects[0]
+}
+
+// splitList splits a comma-separated flag value, dropping empty elements.
+func splitList(v string) []string {
+	var list []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// jobID returns the --job_id given when exactly one was.
+func (f *jobFlags) jobID() string {
+	if len(f.jobIDs.stringList) != 1 {
+		return ""
+	}
+	return f.jobIDs.stringList[0]
+}
+
+// template returns the --template_path or --flex_template given, if any.
+func (f *jobFlags) template() string {
+	if f.flexTemplate != "" {
+		return f.flexTemplate
+	}
+	return f.templatePath
+}
+
+// context returns the context of a run of the command, cancelled on SIGINT
+// or SIGTERM and once --deadline expires.
+func (f *jobFlags) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signalContext()
+	if f.deadline <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, f.deadline, fmt.Errorf("--deadline (%v) exceeded: %w", f.deadline, errDeadline))
+	runCtx = ctx
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// gcloudConfigDir returns the gcloud configuration directory, honouring
+// CLOUDSDK_CONFIG like gcloud does.
+func gcloudConfigDir() string {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gcloud")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gcloud")
+}
+
+// gcloudProperty returns a property of the active gcloud configuration, e.g.
+// section "core" and name "project", or "" if it is not set. Like gcloud, a
+// CLOUDSDK_SECTION_NAME environment variable takes precedence over the
+// configuration file. gcloud itself is not run, as it can be slow to start.
+func gcloudProperty(section, name string) string {
+	if v := os.Getenv("CLOUDSDK_" + strings.ToUpper(section) + "_" + strings.ToUpper(name)); v != "" {
+		return v
+	}
+	dir := gcloudConfigDir()
+	if dir == "" {
+		return ""
+	}
+
+	config := os.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME")
+	if config == "" {
+		active, err := os.ReadFile(filepath.Join(dir, "active_config"))
+		if err != nil {
+			return ""
+		}
+		config = strings.TrimSpace(string(active))
+	}
+	f, err := os.Open(filepath.Join(dir, "configurations", "config_"+config))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// The configuration is an INI file with one section per property group.
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if ok && current == section && strings.TrimSpace(k) == name {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// applyGcloudDefaults fills an empty project or location from the active
+// gcloud configuration's core/project and dataflow/region properties.
+func applyGcloudDefaults(projectID, location *string) {
+	if *projectID == "" {
+		*projectID = gcloudProperty("core", "project")
+	}
+	if *location == "" {
+		*location = gcloudProperty("dataflow", "region")
+	}
+}
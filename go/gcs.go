@@ -0,0 +1,70 @@
+package main
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/option"
+	"strings"
+)
+
+// gcsSink uploads every result as JSON to a single GCS object so other jobs
+// can read the latest count without calling the Dataflow API.
+//
+// When a generation precondition is given, the first upload only succeeds if
+// the object's generation matches it (0 meaning the object must not exist),
+// and every later upload requires the generation written by the previous one,
+// so concurrent writers are detected instead of silently overwritten.
+type gcsSink struct {
+	client     *storage.Client
+	object     *storage.ObjectHandle
+	uri        string
+	generation int64 // < 0 disables preconditions.
+}
+
+func newGCSSink(ctx context.Context, uri string, ifGenerationMatch int64, opts ...option.ClientOption) (*gcsSink, error) {
+	bucket, name, ok := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if !strings.HasPrefix(uri, "gs://") || !ok || bucket == "" || name == "" {
+		return nil, fmt.Errorf("invalid --gcs_output %q, expected 'gs://bucket/path.json'", uri)
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsSink{client: client, object: client.Bucket(bucket).Object(name), uri: uri, generation: ifGenerationMatch}, nil
+}
+
+func (s *gcsSink) Send(ctx context.Context, _, cur *workercount.Result) error {
+	data, err := json.Marshal(cur)
+	if err != nil {
+		return err
+	}
+
+	obj := s.object
+	switch {
+	case s.generation == 0:
+		obj = obj.If(storage.Conditions{DoesNotExist: true})
+	case s.generation > 0:
+		obj = obj.If(storage.Conditions{GenerationMatch: s.generation})
+	}
+	w := obj.NewWriter(ctx)
+	w.ContentType = "application/json"
+	w.CacheControl = "no-cache"
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("writing %s: %w", s.uri, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", s.uri, err)
+	}
+	if s.generation >= 0 {
+		s.generation = w.Attrs().Generation
+	}
+	return nil
+}
+
+func (s *gcsSink) Close() error {
+	return s.client.Close()
+}
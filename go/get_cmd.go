@@ -0,0 +1,104 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// runGet implements the "get" subcommand: a single lookup of each selected job
+// printed to stdout and forwarded to any configured sinks.
+func runGet(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	jf := registerJobFlags(fs)
+	of := registerOutputFlags(fs)
+	sf := registerSinkFlags(fs)
+	stateFile := fs.String("state_file", "", stateFileUsage)
+	staleExitCode := fs.Int("stale_exit_code", exitStale, "Optional: Exit with this code after printing the results if any is older than --max_event_age. 0 only warns.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s get [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Retrieves the latest Dataflow job worker counts within a specified time window.\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+
+	jf.includeEvents = (of.chart && of.output == outputText) || sf.dumpEvents != ""
+	jf.validate(fs)
+	p := of.printer()
+	state := loadState(*stateFile)
+
+	ctx, cancel := jf.context()
+	defer cancel()
+	client := jf.newClient(ctx)
+	defer client.Close()
+	sinks := sf.open(ctx, jf)
+	defer closeSinks(sinks)
+
+	targets, err := jf.targets(ctx, client)
+	if err != nil {
+		exitWithError(err)
+	}
+	if len(targets) == 0 {
+		exitf(exitNotFound, "No active jobs match the job selector.")
+	}
+	p.multi = jf.multiJob()
+
+	state.apply(targets)
+	results := fetchTargets(ctx, client, targets, jf.concurrency, p)
+	if err := state.update(results); err != nil {
+		log.Printf("WARN: %v", err)
+	}
+	// failed is the exit code of the first failed lookup, other than for
+	// --require_state.
+	failed, unexpectedState, overBudget, stale := 0, false, false, false
+	for _, r := range results {
+		if r.err != nil && !jf.multiJob() {
+			exitOnFetchError(r.err, r.opts)
+		}
+		if r.err != nil {
+			logError(r.opts.Job(), r.err)
+			if errors.Is(r.err, workercount.ErrUnexpectedState) {
+				unexpectedState = true
+			} else if failed == 0 {
+				failed = exitCode(r.err)
+			}
+			continue
+		}
+		if warnIfStale(r.res, r.opts) {
+			stale = true
+		}
+		warnIfQuotaInsufficient(r.res)
+		warnIfInstancesDiverge(r.res)
+		if warnIfOverBudget(r.res) {
+			overBudget = true
+		}
+		sendToSinks(ctx, sinks, nil, r.res)
+	}
+	if err := p.printResults(results); err != nil {
+		logError("", err)
+		if failed == 0 {
+			failed = exitFailure
+		}
+	}
+	code := 0
+	switch {
+	case failed != 0:
+		code = failed
+	case unexpectedState:
+		code = exitUnexpectedState
+	case overBudget:
+		code = exitOverBudget
+	case stale:
+		code = *staleExitCode
+	}
+	if code != 0 {
+		// Close explicitly since os.Exit skips deferred calls.
+		closeSinks(sinks)
+		client.Close()
+		os.Exit(code)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"dataflow_worker_count/fakedataflow"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// toolArgsEnv makes the test binary run the tool with the newline-separated
+// arguments it holds instead of the tests, so that commands exiting the
+// process can be tested end to end.
+const toolArgsEnv = "DATAFLOW_WORKER_COUNT_TEST_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(toolArgsEnv); ok {
+		os.Args = append([]string{"dataflow_worker_count"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTool runs the tool with args, returning its standard output and exit
+// code.
+func runTool(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), toolArgsEnv+"="+strings.Join(args, "\n"))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("running %q failed: %v", args, err)
+	}
+	if stderr.Len() > 0 {
+		t.Logf("stderr of %q:\n%s", args, stderr.String())
+	}
+	return stdout.String(), cmd.ProcessState.ExitCode()
+}
+
+// fakeFlags starts a fake Dataflow API serving the demo jobs for the duration
+// of the test, returning the flags pointing the tool at it.
+func fakeFlags(t *testing.T) []string {
+	t.Helper()
+	addr, stop, err := fakedataflow.NewServer(fakedataflow.DemoJobs(time.Now().UTC())...).Start("localhost:0")
+	if err != nil {
+		t.Fatalf("starting the fake Dataflow API failed: %v", err)
+	}
+	t.Cleanup(stop)
+	return []string{
+		"--api_endpoint=" + addr,
+		"--insecure",
+		"--project_id=" + fakedataflow.DemoProjectID,
+		"--location=" + fakedataflow.DemoLocation,
+	}
+}
+
+func TestGetAgainstFake(t *testing.T) {
+	flags := fakeFlags(t)
+	// The default page size of the fake splits the events across pages,
+	// some without messages, as does a page size of 1.
+	for _, pageSize := range []string{"0", "1", "100"} {
+		t.Run("page_size="+pageSize, func(t *testing.T) {
+			args := append([]string{"get"}, flags...)
+			args = append(args, "--job_id="+fakedataflow.DemoJobID, "--lookback=2h", "--output=json", "--page_size="+pageSize)
+			out, code := runTool(t, args...)
+			if code != 0 {
+				t.Fatalf("get exited with code %d, want 0", code)
+			}
+			var res struct {
+				JobID          string `json:"job_id"`
+				CurrentWorkers int64  `json:"current_workers"`
+				TargetWorkers  int64  `json:"target_workers"`
+				DesiredWorkers int64  `json:"desired_workers"`
+			}
+			if err := json.Unmarshal([]byte(out), &res); err != nil {
+				t.Fatalf("decoding the output %q failed: %v", out, err)
+			}
+			if res.JobID != fakedataflow.DemoJobID || res.CurrentWorkers != 5 || res.TargetWorkers != 5 || res.DesiredWorkers != 5 {
+				t.Errorf("get returned %+v, want 5 current, target and desired workers of job %s", res, fakedataflow.DemoJobID)
+			}
+		})
+	}
+}
+
+func TestGetAgainstFakeWindowWithoutEvents(t *testing.T) {
+	args := append([]string{"get"}, fakeFlags(t)...)
+	args = append(args, "--job_id="+fakedataflow.DemoJobID, "--lookback=5m")
+	if _, code := runTool(t, args...); code != exitNoEvents {
+		t.Errorf("get exited with code %d, want %d", code, exitNoEvents)
+	}
+}
+
+func TestGetAgainstFakeUnknownJob(t *testing.T) {
+	args := append([]string{"get"}, fakeFlags(t)...)
+	args = append(args, "--job_id=unknown", "--lookback=2h", "--fetch_job_status")
+	if _, code := runTool(t, args...); code != exitNotFound {
+		t.Errorf("get exited with code %d, want %d", code, exitNotFound)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"dataflow_worker_count/workercount"
+	"fmt"
+	_ "modernc.org/sqlite" // Registers the pure Go "sqlite" database/sql driver.
+	"time"
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS observations (
+	observed_at     INTEGER NOT NULL, -- Unix milliseconds, UTC.
+	project_id      TEXT    NOT NULL,
+	location        TEXT    NOT NULL,
+	job_id          TEXT    NOT NULL,
+	current_workers INTEGER NOT NULL,
+	target_workers  INTEGER NOT NULL,
+	desired_workers INTEGER NOT NULL,
+	state           TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS observations_by_job ON observations (project_id, location, job_id, observed_at);
+`
+
+// observation is a single recorded result.
+type observation struct {
+	ObservedAt     time.Time `json:"observed_at"`
+	ProjectID      string    `json:"project_id"`
+	Location       string    `json:"location"`
+	JobID          string    `json:"job_id"`
+	CurrentWorkers int64     `json:"current_workers"`
+	TargetWorkers  int64     `json:"target_workers"`
+	DesiredWorkers int64     `json:"desired_workers"`
+	State          string    `json:"state"`
+}
+
+// historyFilter selects observations; empty fields match everything.
+type historyFilter struct {
+	ProjectID, Location, JobID string
+	Start, End                 time.Time
+}
+
+// historyStore is an embedded SQLite database of observations.
+type historyStore struct {
+	db *sql.DB
+}
+
+func openHistoryStore(path string) (*historyStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing history database %s: %w", path, err)
+	}
+	return &historyStore{db: db}, nil
+}
+
+func (s *historyStore) Record(ctx context.Context, at time.Time, res *workercount.Result) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO observations (observed_at, project_id, location, job_id, current_workers, target_workers, desired_workers, state)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		at.UnixMilli(), res.ProjectID, res.Location, res.JobID, res.CurrentWorkers, res.TargetWorkers, res.DesiredWorkers, res.JobStatus)
+	if err != nil {
+		return fmt.Errorf("recording observation: %w", err)
+	}
+	return nil
+}
+
+// Query returns the observations matching f, oldest first.
+func (s *historyStore) Query(ctx context.Context, f historyFilter) ([]observation, error) {
+	return s.query(ctx, f, "ORDER BY observed_at ASC")
+}
+
+// Latest returns the most recent observation matching f, or nil if none.
+func (s *historyStore) Latest(ctx context.Context, f historyFilter) (*observation, error) {
+	obs, err := s.query(ctx, f, "ORDER BY observed_at DESC LIMIT 1")
+	if err != nil || len(obs) == 0 {
+		return nil, err
+	}
+	return &obs[0], nil
+}
+
+func (s *historyStore) query(ctx context.Context, f historyFilter, suffix string) ([]observation, error) {
+	q := `SELECT observed_at, project_id, location, job_id, current_workers, target_workers, desired_workers, state
+	      FROM observations WHERE 1 = 1`
+	var args []any
+	for _, c := range []struct{ column, value string }{
+		{"project_id", f.ProjectID},
+		{"location", f.Location},
+		{"job_id", f.JobID},
+	} {
+		if c.value != "" {
+			q += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if !f.Start.IsZero() {
+		q += " AND observed_at >= ?"
+		args = append(args, f.Start.UnixMilli())
+	}
+	if !f.End.IsZero() {
+		q += " AND observed_at <= ?"
+		args = append(args, f.End.UnixMilli())
+	}
+
+	rows, err := s.db.QueryContext(ctx, q+" "+suffix, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying history: %w", err)
+	}
+	defer rows.Close()
+
+	var obs []observation
+	for rows.Next() {
+		var o observation
+		var ms int64
+		if err := rows.Scan(&ms, &o.ProjectID, &o.Location, &o.JobID, &o.CurrentWorkers, &o.TargetWorkers, &o.DesiredWorkers, &o.State); err != nil {
+			return nil, fmt.Errorf("querying history: %w", err)
+		}
+		o.ObservedAt = time.UnixMilli(ms).UTC()
+		obs = append(obs, o)
+	}
+	return obs, rows.Err()
+}
+
+func (s *historyStore) Close() error {
+	return s.db.Close()
+}
+
+// historySink records every result in a historyStore.
+type historySink struct {
+	store *historyStore
+}
+
+func (s *historySink) Send(ctx context.Context, _, cur *workercount.Result) error {
+	return s.store.Record(ctx, time.Now(), cur)
+}
+
+func (s *historySink) Close() error {
+	return s.store.Close()
+}
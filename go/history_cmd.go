@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const historyUsage = `Usage: %[1]s history <list|stats> --history_db=PATH [flags]
+
+Queries observations recorded with --history_db.
+
+  list    Print every observation in the time range, oldest first.
+  stats   Summarize desired workers over the time range.
+
+`
+
+// runHistory implements the "history" subcommands.
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	historyDB := fs.String("history_db", "", "Path to the SQLite history database. (required)")
+	projectID := fs.String("project_id", "", "Optional: Only include observations for this project.")
+	location := fs.String("location", "", "Optional: Only include observations for this location.")
+	jobID := fs.String("job_id", "", "Optional: Only include observations for this job.")
+	since := fs.Duration("since", 24*time.Hour, "Optional: How far back to look when --start_time is not set.")
+	startTime := fs.String("start_time", "", "Optional: RFC3339 start of the time range.")
+	endTime := fs.String("end_time", "", "Optional: RFC3339 end of the time range. Defaults to now.")
+	output := fs.String("output", outputText, "Optional: Output format: 'text' or 'json'.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, historyUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	var sub string
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	parseFlags(fs, args)
+	if sub == "" {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if *historyDB == "" {
+		log.Println("Error: --history_db is required.")
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if *output != outputText && *output != outputJSON {
+		exitf(exitUsage, "--output must be %q or %q, got %q.", outputText, outputJSON, *output)
+	}
+
+	f := historyFilter{ProjectID: *projectID, Location: *location, JobID: *jobID, End: time.Now()}
+	var err error
+	if *endTime != "" {
+		if f.End, err = time.Parse(time.RFC3339, *endTime); err != nil {
+			exitf(exitUsage, "Invalid --end_time: %v", err)
+		}
+	}
+	f.Start = f.End.Add(-*since)
+	if *startTime != "" {
+		if f.Start, err = time.Parse(time.RFC3339, *startTime); err != nil {
+			exitf(exitUsage, "Invalid --start_time: %v", err)
+		}
+	}
+
+	store, err := openHistoryStore(*historyDB)
+	if err != nil {
+		exitWithError(err)
+	}
+	defer store.Close()
+
+	obs, err := store.Query(context.Background(), f)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	switch sub {
+	case "list":
+		printHistoryList(obs, *output)
+	case "stats":
+		printHistoryStats(obs, *output)
+	default:
+		log.Printf("Error: unknown history subcommand %q.", sub)
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+func printHistoryList(obs []observation, output string) {
+	if output == outputJSON {
+		if obs == nil {
+			obs = []observation{}
+		}
+		json.NewEncoder(os.Stdout).Encode(obs)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tPROJECT\tLOCATION\tJOB\tCURRENT\tTARGET\tDESIRED\tSTATE")
+	for _, o := range obs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			o.ObservedAt.Format(time.RFC3339), o.ProjectID, o.Location, o.JobID, o.CurrentWorkers, o.TargetWorkers, o.DesiredWorkers, o.State)
+	}
+	tw.Flush()
+}
+
+// historyStats summarizes desired workers across observations.
+type historyStats struct {
+	Count      int       `json:"count"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+	MinDesired int64     `json:"min_desired_workers"`
+	MaxDesired int64     `json:"max_desired_workers"`
+	AvgDesired float64   `json:"avg_desired_workers"`
+}
+
+func printHistoryStats(obs []observation, output string) {
+	if len(obs) == 0 {
+		exitf(exitNotFound, "No recorded observations in the time range.")
+	}
+	st := historyStats{Count: len(obs), First: obs[0].ObservedAt, Last: obs[len(obs)-1].ObservedAt, MinDesired: obs[0].DesiredWorkers, MaxDesired: obs[0].DesiredWorkers}
+	var sum int64
+	for _, o := range obs {
+		st.MinDesired = min(st.MinDesired, o.DesiredWorkers)
+		st.MaxDesired = max(st.MaxDesired, o.DesiredWorkers)
+		sum += o.DesiredWorkers
+	}
+	st.AvgDesired = float64(sum) / float64(len(obs))
+
+	if output == outputJSON {
+		json.NewEncoder(os.Stdout).Encode(st)
+		return
+	}
+	fmt.Printf("Observations: %d (%s to %s)\n", st.Count, st.First.Format(time.RFC3339), st.Last.Format(time.RFC3339))
+	fmt.Printf("Min Desired Workers: %d\n", st.MinDesired)
+	fmt.Printf("Max Desired Workers: %d\n", st.MaxDesired)
+	fmt.Printf("Avg Desired Workers: %.1f\n", st.AvgDesired)
+}
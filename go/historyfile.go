@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// historyFileTimeFormat names the rotated --history_file backups, sorting
+// them oldest first. Its nanoseconds keep rotations within the same second
+// from overwriting each other's backups.
+const historyFileTimeFormat = "20060102T150405.000000000Z"
+
+// historyFileSink appends every result to --history_file as a JSON line,
+// rotating the file once it reaches maxSize bytes or maxAge.
+type historyFileSink struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	// f is nil after a failed rotation, until Send reopens the file.
+	f    *os.File
+	size int64
+	// started is the time of the first observation in the file.
+	started time.Time
+}
+
+func newHistoryFileSink(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*historyFileSink, error) {
+	s := &historyFileSink{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the file for appending, reading the time of its first
+// observation if it has any.
+func (s *historyFileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening --history_file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening --history_file: %w", err)
+	}
+	s.f, s.size, s.started = f, info.Size(), time.Time{}
+	var first observation
+	if line, err := bufio.NewReader(f).ReadBytes('\n'); err == nil && json.Unmarshal(line, &first) == nil {
+		s.started = first.ObservedAt
+	}
+	return nil
+}
+
+func (s *historyFileSink) Send(_ context.Context, _, cur *workercount.Result) error {
+	now := time.Now().UTC()
+	line, err := json.Marshal(observation{
+		ObservedAt:     now,
+		ProjectID:      cur.ProjectID,
+		Location:       cur.Location,
+		JobID:          cur.JobID,
+		CurrentWorkers: cur.CurrentWorkers,
+		TargetWorkers:  cur.TargetWorkers,
+		DesiredWorkers: cur.DesiredWorkers,
+		State:          cur.JobStatus,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.size > 0 && (s.maxSize > 0 && s.size+int64(len(line)) > s.maxSize || s.maxAge > 0 && now.Sub(s.started) >= s.maxAge) {
+		if err := s.rotate(now); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	if s.started.IsZero() {
+		s.started = now
+	}
+	if err != nil {
+		return fmt.Errorf("writing --history_file: %w", err)
+	}
+	return nil
+}
+
+// rotate renames the file to a backup named after now, removes the oldest
+// backups beyond maxBackups and starts a new file. If it fails, the file is
+// left closed for the next Send to reopen and rotate again.
+func (s *historyFileSink) rotate(now time.Time) error {
+	err := s.f.Close()
+	s.f = nil
+	if err != nil {
+		return fmt.Errorf("rotating --history_file: %w", err)
+	}
+	if err := os.Rename(s.path, s.path+"."+now.Format(historyFileTimeFormat)); err != nil {
+		return fmt.Errorf("rotating --history_file: %w", err)
+	}
+	if s.maxBackups > 0 {
+		backups, err := filepath.Glob(s.path + ".[0-9]*")
+		if err != nil {
+			return err
+		}
+		sort.Strings(backups)
+		for len(backups) > s.maxBackups {
+			if err := os.Remove(backups[0]); err != nil {
+				return fmt.Errorf("rotating --history_file: %w", err)
+			}
+			backups = backups[1:]
+		}
+	}
+	return s.open()
+}
+
+func (s *historyFileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// historyLines returns the lines of the history file at path.
+func historyLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s failed: %v", path, err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestHistoryFileRotatesWithinSecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	// Every observation exceeds maxSize, so each Send after the first
+	// rotates, all within the same second.
+	s, err := newHistoryFileSink(path, 1, 0, 2)
+	if err != nil {
+		t.Fatalf("newHistoryFileSink() failed: %v", err)
+	}
+	defer s.Close()
+	res := &workercount.Result{ProjectID: "project", Location: "region", JobID: "job", CurrentWorkers: 3}
+	for i := 0; i < 4; i++ {
+		if err := s.Send(context.Background(), nil, res); err != nil {
+			t.Fatalf("Send() #%d failed: %v", i+1, err)
+		}
+	}
+
+	backups, err := filepath.Glob(path + ".[0-9]*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("rotating 3 times kept backups %q, want 2", backups)
+	}
+	for _, b := range append(backups, path) {
+		if lines := historyLines(t, b); len(lines) != 1 {
+			t.Errorf("%s holds %d observations, want 1", b, len(lines))
+		}
+	}
+}
+
+func TestHistoryFileReopensAfterFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := newHistoryFileSink(path, 1, 0, 0)
+	if err != nil {
+		t.Fatalf("newHistoryFileSink() failed: %v", err)
+	}
+	defer s.Close()
+	res := &workercount.Result{ProjectID: "project", Location: "region", JobID: "job", CurrentWorkers: 3}
+	if err := s.Send(context.Background(), nil, res); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	// Renaming the removed file fails the rotation.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(context.Background(), nil, res); err == nil {
+		t.Fatal("Send() rotating a removed file succeeded, want an error")
+	}
+	if err := s.Send(context.Background(), nil, res); err != nil {
+		t.Fatalf("Send() after a failed rotation failed: %v", err)
+	}
+	if lines := historyLines(t, path); len(lines) != 1 {
+		t.Errorf("%s holds %d observations after the failed rotation, want 1", path, len(lines))
+	}
+}
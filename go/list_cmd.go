@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runList implements the "list" subcommand.
+func runList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	projectID := fs.String("project_id", "", "Your Google Cloud project ID. Defaults to the gcloud core/project property. (required)")
+	location := fs.String("location", "", "The regional endpoint to list jobs in (e.g., 'us-central1'). Defaults to the gcloud dataflow/region property. (required)")
+	cf := registerClientFlags(fs)
+	filter := fs.String("filter", workercount.JobFilterActive, "Optional: Which jobs to list: 'active', 'terminated', or 'all'.")
+	output := fs.String("output", outputText, "Optional: Output format: 'text' or 'json'.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s list --project_id=PROJECT --location=LOCATION [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Lists the Dataflow jobs in a project and location.\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+
+	applyGcloudDefaults(projectID, location)
+	if *projectID == "" || *location == "" {
+		log.Println("Error: --project_id and --location are required.")
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if *output != outputText && *output != outputJSON {
+		exitf(exitUsage, "--output must be %q or %q, got %q.", outputText, outputJSON, *output)
+	}
+
+	ctx := context.Background()
+	client := cf.newClient(ctx)
+	defer client.Close()
+
+	jobs, err := client.ListJobs(ctx, *projectID, *location, *filter)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if *output == outputJSON {
+		if jobs == nil {
+			jobs = []workercount.JobSummary{}
+		}
+		json.NewEncoder(os.Stdout).Encode(jobs)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB ID\tNAME\tTYPE\tSTATE\tCREATED")
+	for _, j := range jobs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", j.ID, j.Name, j.Type, j.State, j.CreateTime.Format(time.RFC3339))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"context"
+	"dataflow_worker_count/workercount"
+	"fmt"
+	"google.golang.org/api/option"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	monitoredrespb "google.golang.org/genproto/googleapis/api/monitoredres"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// desiredWorkersMetricType is the Cloud Monitoring custom metric written by metricSink.
+const desiredWorkersMetricType = "custom.googleapis.com/dataflow/desired_workers"
+
+// metricSink writes the desired worker count as a custom metric point on the
+// "global" monitored resource, labelled with the job's project, location and ID.
+type metricSink struct {
+	client    *monitoring.MetricClient
+	projectID string
+}
+
+func newMetricSink(ctx context.Context, projectID string, opts ...option.ClientOption) (*metricSink, error) {
+	client, err := monitoring.NewMetricClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &metricSink{client: client, projectID: projectID}, nil
+}
+
+func (s *metricSink) Send(ctx context.Context, _, cur *workercount.Result) error {
+	req := &monitoringpb.CreateTimeSeriesRequest{
+		Name: "projects/" + s.projectID,
+		TimeSeries: []*monitoringpb.TimeSeries{{
+			Metric: &metricpb.Metric{
+				Type: desiredWorkersMetricType,
+				Labels: map[string]string{
+					"project_id": cur.ProjectID,
+					"location":   cur.Location,
+					"job_id":     cur.JobID,
+				},
+			},
+			Resource: &monitoredrespb.MonitoredResource{
+				Type:   "global",
+				Labels: map[string]string{"project_id": s.projectID},
+			},
+			Points: []*monitoringpb.Point{{
+				Interval: &monitoringpb.TimeInterval{EndTime: timestamppb.Now()},
+				Value: &monitoringpb.TypedValue{
+					Value: &monitoringpb.TypedValue_Int64Value{Int64Value: cur.DesiredWorkers},
+				},
+			}},
+		}},
+	}
+	if err := s.client.CreateTimeSeries(ctx, req); err != nil {
+		return fmt.Errorf("writing %s: %w", desiredWorkersMetricType, err)
+	}
+	return nil
+}
+
+func (s *metricSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"os"
+	"time"
+)
+
+const otelScope = "dataflow_worker_count"
+
+// otelSink records worker count gauges and poll counters with the
+// OpenTelemetry SDK and exports them over OTLP. The exporter is configured
+// through the standard OTEL_EXPORTER_OTLP_* and OTEL_RESOURCE_ATTRIBUTES /
+// OTEL_SERVICE_NAME environment variables; OTEL_EXPORTER_OTLP_PROTOCOL
+// selects between "grpc" (default) and "http/protobuf".
+type otelSink struct {
+	provider *sdkmetric.MeterProvider
+
+	current, target, desired metric.Int64Gauge
+	polls, pollErrors        metric.Int64Counter
+}
+
+func newOtelSink(ctx context.Context) (*otelSink, error) {
+	exp, err := newOtlpExporter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", otelScope)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating OpenTelemetry resource: %w", err)
+	}
+
+	s := &otelSink{provider: sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp)),
+		sdkmetric.WithResource(res),
+	)}
+	meter := s.provider.Meter(otelScope)
+	if s.current, err = meter.Int64Gauge("dataflow.workers.current", metric.WithDescription("Latest current worker count reported by autoscaling events.")); err != nil {
+		return nil, err
+	}
+	if s.target, err = meter.Int64Gauge("dataflow.workers.target", metric.WithDescription("Latest target worker count reported by autoscaling events.")); err != nil {
+		return nil, err
+	}
+	if s.desired, err = meter.Int64Gauge("dataflow.workers.desired", metric.WithDescription("Desired worker count after min/max clamping.")); err != nil {
+		return nil, err
+	}
+	if s.polls, err = meter.Int64Counter("dataflow_worker_count.polls", metric.WithDescription("Successful worker count lookups.")); err != nil {
+		return nil, err
+	}
+	if s.pollErrors, err = meter.Int64Counter("dataflow_worker_count.poll_errors", metric.WithDescription("Failed worker count lookups.")); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newOtlpExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch protocol {
+	case "", "grpc":
+		return otlpmetricgrpc.New(ctx)
+	case "http/protobuf":
+		return otlpmetrichttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+}
+
+func jobAttributes(projectID, location, jobID string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("project_id", projectID),
+		attribute.String("location", location),
+		attribute.String("job_id", jobID),
+	)
+}
+
+func (s *otelSink) Send(ctx context.Context, _, cur *workercount.Result) error {
+	attrs := jobAttributes(cur.ProjectID, cur.Location, cur.JobID)
+	s.current.Record(ctx, cur.CurrentWorkers, attrs)
+	s.target.Record(ctx, cur.TargetWorkers, attrs)
+	s.desired.Record(ctx, cur.DesiredWorkers, attrs)
+	s.polls.Add(ctx, 1, attrs)
+	return nil
+}
+
+func (s *otelSink) ObserveError(ctx context.Context, opts workercount.Options, _ error) {
+	s.pollErrors.Add(ctx, 1, jobAttributes(opts.ProjectID, opts.Location, opts.JobID))
+}
+
+// Close flushes pending metrics before shutting the exporter down.
+func (s *otelSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.provider.Shutdown(ctx)
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bytes"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Supported --output formats.
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputInflux = "influx"
+)
+
+// influxMeasurement is the line protocol measurement name used by --output=influx.
+const influxMeasurement = "dataflow_workers"
+
+// printer renders results to stdout in the selected --output format.
+type printer struct {
+	w       io.Writer
+	format  string
+	verbose bool
+	// file, if set, receives the results instead of w, replaced as a whole.
+	file string
+	// multi identifies the job in text output, as several jobs are printed.
+	multi bool
+	// aggregate, if set, replaces the results of the individual jobs with
+	// their combined worker counts.
+	aggregate string
+	// groupBy, if set, combines the worker counts of each group of jobs.
+	groupBy string
+	// sortBy orders the results of several jobs.
+	sortBy string
+	// chart adds sparklines of the worker counts to verbose text output.
+	chart bool
+	// loc is the time zone of printed times; nil means UTC.
+	loc *time.Location
+}
+
+// outputFlags select how results are printed.
+type outputFlags struct {
+	verbose   bool
+	output    string
+	aggregate string
+	groupBy   string
+	sortBy    string
+	chart     bool
+	timezone  string
+	file      string
+}
+
+func registerOutputFlags(fs *flag.FlagSet) *outputFlags {
+	f := &outputFlags{}
+	fs.BoolVar(&f.verbose, "verbose", true, "Optional: If false, only prints the desired worker count. Defaults to true for detailed output.")
+	fs.StringVar(&f.output, "output", outputText, "Optional: Output format: 'text', 'json', or 'influx' (line protocol, e.g. for the Telegraf exec input). --verbose only applies to 'text'.")
+	fs.StringVar(&f.aggregate, "aggregate", "", "Optional: Print the worker counts of all selected jobs combined with 'sum' or 'max' instead of each job's result.")
+	fs.StringVar(&f.groupBy, "group_by", "", "Optional: Print the worker counts combined per group of jobs instead of each job's result: 'label:KEY' groups by a Dataflow job label, e.g. 'label:team'; 'project' or 'location' by where jobs run. Combines with --aggregate, which defaults to 'sum'.")
+	fs.BoolVar(&f.chart, "chart", false, "Optional: Add sparklines of the current and target workers over the window to verbose text output.")
+	fs.StringVar(&f.timezone, "timezone", "UTC", "Optional: IANA time zone of printed times, e.g. 'America/New_York' or 'Local'.")
+	fs.StringVar(&f.sortBy, "sort", sortDesired, "Optional: Order of the results of several jobs: 'desired' (most desired workers first), 'name' or 'state'.")
+	fs.StringVar(&f.file, "output_file", "", "Optional: Write the results to this file instead of stdout, through a temporary file renamed over it, so readers never see partial content. watch replaces it on every poll.")
+	return f
+}
+
+// printer returns the selected printer, exiting if the format is unknown.
+func (f *outputFlags) printer() *printer {
+	p, err := newPrinter(f.output, f.verbose)
+	if err == nil {
+		err = validateAggregate(f.aggregate)
+	}
+	if err == nil {
+		err = validateGroupBy(f.groupBy)
+	}
+	if err == nil {
+		err = validateSort(f.sortBy)
+	}
+	if err != nil {
+		exitf(exitUsage, "%v", err)
+	}
+	if p.loc, err = time.LoadLocation(f.timezone); err != nil {
+		exitf(exitUsage, "Invalid --timezone: %v", err)
+	}
+	p.aggregate, p.groupBy, p.sortBy, p.chart, p.file = f.aggregate, f.groupBy, f.sortBy, f.chart, f.file
+	if p.groupBy != "" && p.aggregate == "" {
+		p.aggregate = aggregateSum
+	}
+	return p
+}
+
+func newPrinter(format string, verbose bool) (*printer, error) {
+	switch format {
+	case outputText, outputJSON, outputInflux:
+	default:
+		return nil, fmt.Errorf("--output must be one of %q, %q or %q, got %q", outputText, outputJSON, outputInflux, format)
+	}
+	return &printer{w: os.Stdout, format: format, verbose: verbose}, nil
+}
+
+// progress prints a status line for humans. It is suppressed unless the
+// output is verbose text, so machine-readable output stays parseable, and a
+// nil printer prints nothing.
+func (p *printer) progress(format string, args ...any) {
+	if p != nil && p.format == outputText && p.verbose {
+		fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+// location returns the time zone of printed times.
+func (p *printer) location() *time.Location {
+	if p == nil || p.loc == nil {
+		return time.UTC
+	}
+	return p.loc
+}
+
+func (p *printer) print(res *workercount.Result, opts workercount.Options) {
+	switch p.format {
+	case outputJSON:
+		if err := json.NewEncoder(p.w).Encode(res); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: encoding result: %v\n", err)
+		}
+	case outputInflux:
+		fmt.Fprintln(p.w, influxLine(res, time.Now()))
+	default:
+		p.printText(res, opts)
+	}
+}
+
+// printText prints only the desired worker count unless verbose.
+func (p *printer) printText(res *workercount.Result, opts workercount.Options) {
+	if !p.verbose && res.Stat != "" {
+		fmt.Fprintln(p.w, formatStat(res))
+		return
+	}
+	if !p.verbose {
+		fmt.Fprintln(p.w, res.DesiredWorkers)
+		return
+	}
+
+	if loc := p.location(); loc != time.UTC {
+		fmt.Fprintf(p.w, "\n--- Results (times in %s) ---\n", loc)
+	} else {
+		fmt.Fprintln(p.w, "\n--- Results ---")
+	}
+	if res.JobStatus != "N/A" {
+		fmt.Fprintf(p.w, "Job Status: %s\n", res.JobStatus)
+	}
+	if res.JobType != "" {
+		fmt.Fprintf(p.w, "Job Type: %s\n", res.JobType)
+	}
+	if res.FlexRS {
+		fmt.Fprintf(p.w, "FlexRS: yes (%s)\n", res.FlexRSGoal)
+	} else if opts.JobDetails {
+		fmt.Fprintln(p.w, "FlexRS: no")
+	}
+	if opts.JobDetails {
+		fmt.Fprintf(p.w, "Dataflow Prime: %s\n", yesNo(res.Prime))
+		fmt.Fprintf(p.w, "Streaming Engine: %s\n", yesNo(res.StreamingEngine))
+	}
+	if m := res.Metadata; m != nil {
+		fmt.Fprintf(p.w, "Created: %s\n", m.CreateTime.In(p.location()).Format(time.RFC3339))
+		if !m.StartTime.IsZero() {
+			fmt.Fprintf(p.w, "Started: %s\n", m.StartTime.In(p.location()).Format(time.RFC3339))
+		}
+		if m.SDK != "" {
+			fmt.Fprintf(p.w, "SDK: %s %s (%s)\n", m.SDK, m.SDKVersion, m.SDKSupportStatus)
+		}
+		fmt.Fprintf(p.w, "Runner: %s\n", m.RunnerVersion)
+	}
+	if a := res.AutoscalingOptions; a != nil {
+		fmt.Fprintf(p.w, "Autoscaling Options: numWorkers=%d maxNumWorkers=%d autoscalingAlgorithm=%s workerMachineType=%s\n",
+			a.NumWorkers, a.MaxNumWorkers, orNA(a.AutoscalingAlgorithm), orNA(a.WorkerMachineType))
+	}
+	switch res.Source {
+	case workercount.SourceMonitoring:
+		fmt.Fprintln(p.w, "Source: Cloud Monitoring (no autoscaling events found)")
+	case workercount.SourceJobConfig:
+		fmt.Fprintln(p.w, "Source: job configuration (no autoscaling events found)")
+	}
+	if res.Window != "" {
+		fmt.Fprintf(p.w, "Events Found: %s\n", res.Window)
+	}
+	if res.Stale {
+		fmt.Fprintf(p.w, "Latest Event: %s (stale)\n", res.LatestEventTime.In(p.location()).Format(time.RFC3339))
+	}
+	if res.Truncated {
+		fmt.Fprintf(p.w, "Events Examined: stopped at --max_events=%d\n", opts.MaxEvents)
+	}
+
+	fmt.Fprintf(p.w, "Latest Current Workers: %v\n", res.CurrentWorkers)
+	if res.CurrentEventDescription != "" {
+		fmt.Fprintf(p.w, "  Reason: %s\n", res.CurrentEventDescription)
+	}
+	if opts.CheckTargetWorkers {
+		fmt.Fprintf(p.w, "Latest Target Workers: %v\n", res.TargetWorkers)
+		if res.TargetEventDescription != "" {
+			fmt.Fprintf(p.w, "  Reason: %s\n", res.TargetEventDescription)
+		}
+	}
+	fmt.Fprintf(p.w, "Min Workers: %d\n", res.MinWorkers)
+	fmt.Fprintf(p.w, "Max Workers: %d\n", res.MaxWorkers)
+	fmt.Fprintf(p.w, "Latest Desired Workers: %v\n", res.DesiredWorkers)
+	if res.Stat != "" {
+		fmt.Fprintf(p.w, "Workers (%s over the window): %s\n", res.Stat, formatStat(res))
+	}
+	if res.Trend != "" {
+		fmt.Fprintf(p.w, "Trend: %s\n", res.Trend)
+	}
+	if res.WorkersPerMinute != nil {
+		fmt.Fprintf(p.w, "Workers Added Per Minute: %.2f\n", *res.WorkersPerMinute)
+	}
+	if opts.Histogram {
+		fmt.Fprintln(p.w, "Time At Each Worker Count:")
+		tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+		for _, h := range res.Histogram {
+			fmt.Fprintf(tw, "  %d workers\tfor %v\n", h.Workers, time.Duration(h.Seconds*float64(time.Second)).Round(time.Second))
+		}
+		tw.Flush()
+	}
+	if res.WatermarkAgeSeconds != nil {
+		fmt.Fprintf(p.w, "Data Watermark Age: %v\n", time.Duration(*res.WatermarkAgeSeconds*float64(time.Second)).Round(time.Second))
+	}
+	if r := res.Resources; r != nil {
+		fmt.Fprintf(p.w, "Resources: %d x %s = %d vCPUs / %s GB\n", res.DesiredWorkers, res.MachineType, r.TotalVCPUs, strconv.FormatFloat(r.TotalMemoryGB, 'f', -1, 64))
+	} else if opts.Resources && res.MachineType != "" {
+		fmt.Fprintf(p.w, "Machine Type: %s (resources unknown)\n", res.MachineType)
+	}
+	if g := res.GPUs; g != nil {
+		fmt.Fprintf(p.w, "GPUs: %d x %d %s = %d\n", res.DesiredWorkers, g.PerWorker, g.Type, g.Total)
+	}
+	if c := res.Cost; c != nil {
+		fmt.Fprintf(p.w, "Estimated Cost: $%.2f/hour (%d x %s at $%.4f/hour)\n", c.Hourly, res.DesiredWorkers, res.MachineType, c.WorkerHourly)
+		if res.OverBudget {
+			fmt.Fprintf(p.w, "Over Budget: $%.2f/hour exceeds $%g/hour\n", c.Hourly, res.MaxHourlyCost)
+		}
+		if w := c.Window; w != nil {
+			covered := time.Duration(w.CoveredSeconds * float64(time.Second)).Round(time.Second)
+			window := time.Duration(w.WindowSeconds * float64(time.Second)).Round(time.Second)
+			if covered < window {
+				fmt.Fprintf(p.w, "Window Cost: $%.2f (%.1f worker hours over %v of the %v window)\n", w.Cost, w.WorkerHours, covered, window)
+			} else {
+				fmt.Fprintf(p.w, "Window Cost: $%.2f (%.1f worker hours over %v)\n", w.Cost, w.WorkerHours, window)
+			}
+		}
+	} else if opts.EstimateCost || opts.WindowCost || opts.MaxHourlyCost > 0 {
+		fmt.Fprintf(p.w, "Estimated Cost: unknown (no price for machine type %q)\n", res.MachineType)
+	}
+	if n := res.Instances; n != nil {
+		diverged := ""
+		if n.Diverged {
+			diverged = fmt.Sprintf(" (DIVERGES from %d current workers)", res.CurrentWorkers)
+		}
+		fmt.Fprintf(p.w, "Worker Instances: %d running, %d total%s\n", n.Running, n.Total, diverged)
+		if len(n.Zones) > 0 {
+			zones := make([]string, 0, len(n.Zones))
+			for zone := range n.Zones {
+				zones = append(zones, zone)
+			}
+			sort.Strings(zones)
+			fmt.Fprintln(p.w, "Worker Zones:")
+			tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+			for _, zone := range zones {
+				fmt.Fprintf(tw, "  %s\t%d running\t%.0f%%\n", zone, n.Zones[zone], 100*float64(n.Zones[zone])/float64(n.Running))
+			}
+			tw.Flush()
+		}
+	}
+	for _, q := range res.Quotas {
+		status := "ok"
+		if !q.Sufficient {
+			status = "INSUFFICIENT"
+		}
+		fmt.Fprintf(p.w, "Quota %s in %s: %g needed by %d workers, %g available (limit %g, usage %g): %s\n", q.Metric, q.Region, q.Needed, q.MaxWorkers, q.Available, q.Limit, q.Usage, status)
+	}
+	if len(res.Pools) > 0 {
+		fmt.Fprintln(p.w, "Worker Pools:")
+		tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+		for _, pool := range res.Pools {
+			fmt.Fprintf(tw, "  %s\t%s\t%d workers", pool.Kind, pool.MachineType, pool.NumWorkers)
+			if pool.MaxNumWorkers > 0 {
+				fmt.Fprintf(tw, " (max %d)", pool.MaxNumWorkers)
+			}
+			fmt.Fprintln(tw)
+		}
+		tw.Flush()
+	}
+	if res.CPU != nil {
+		fmt.Fprintf(p.w, "Worker CPU Utilization: mean %.1f%%, max %.1f%%\n", 100*res.CPU.Mean, 100*res.CPU.Max)
+	}
+	if m := res.Metrics; m != nil {
+		p.printMetrics(m)
+	}
+	if opts.VerticalScaling {
+		fmt.Fprintf(p.w, "Vertical Scaling Events: %d\n", len(res.VerticalScaling))
+		for _, e := range res.VerticalScaling {
+			fmt.Fprintf(p.w, "  %s: %s\n", e.Time.In(p.location()).Format(time.RFC3339), e.Text)
+		}
+		if res.MemoryPerWorkerGB != nil {
+			fmt.Fprintf(p.w, "Memory Per Worker: %s GB\n", strconv.FormatFloat(*res.MemoryPerWorkerGB, 'f', -1, 64))
+		}
+	}
+	if m := res.Messages; m != nil {
+		fmt.Fprintf(p.w, "Error Messages: %d, Warning Messages: %d\n", m.Errors, m.Warnings)
+		for _, c := range m.Top {
+			fmt.Fprintf(p.w, "  %dx %s (last at %s): %s\n", c.Count, strings.TrimPrefix(c.Importance, "JOB_MESSAGE_"), c.LastTime.In(p.location()).Format(time.RFC3339), c.Text)
+		}
+	}
+	if p.chart {
+		end := opts.EndTime
+		if end.IsZero() {
+			end = time.Now()
+		}
+		printChart(p.w, res.Events, end.In(p.location()))
+	}
+	fmt.Fprintln(p.w, "----------------")
+}
+
+// printMetrics prints the job metrics reported, if any.
+func (p *printer) printMetrics(m *workercount.JobMetrics) {
+	if m.SystemLagSeconds != nil {
+		fmt.Fprintf(p.w, "System Lag: %v\n", time.Duration(*m.SystemLagSeconds*float64(time.Second)).Round(time.Second))
+	}
+	if m.BacklogBytes != nil {
+		fmt.Fprintf(p.w, "Backlog Bytes: %d\n", *m.BacklogBytes)
+	}
+	if m.BacklogElements != nil {
+		fmt.Fprintf(p.w, "Backlog Elements: %d\n", *m.BacklogElements)
+	}
+	if m.ElementsPerSecond != nil {
+		fmt.Fprintf(p.w, "Throughput: %.1f elements/s (%d elements since the job started)\n", *m.ElementsPerSecond, *m.Elements)
+	}
+	if m.StreamingEngineComputeUnits != nil {
+		fmt.Fprintf(p.w, "Streaming Engine Compute Units: %s\n", strconv.FormatFloat(*m.StreamingEngineComputeUnits, 'f', -1, 64))
+	}
+	if m.StreamingDataProcessedBytes != nil {
+		fmt.Fprintf(p.w, "Streaming Data Processed: %d bytes\n", *m.StreamingDataProcessedBytes)
+	}
+}
+
+// printResults prints the results of looking up the selected jobs, to
+// --output_file if given. Failed lookups are left to the caller to report.
+func (p *printer) printResults(results []jobResult) error {
+	if p.file == "" {
+		p.writeResults(results)
+		return nil
+	}
+	var buf bytes.Buffer
+	fp := *p
+	fp.w = &buf
+	fp.writeResults(results)
+	if err := writeFileAtomic(p.file, buf.Bytes()); err != nil {
+		return fmt.Errorf("writing --output_file: %w", err)
+	}
+	return nil
+}
+
+// writeResults writes the --group_by or --aggregate results if given, a
+// table with totals for text output about several jobs, or else each result.
+func (p *printer) writeResults(results []jobResult) {
+	switch {
+	case p.groupBy != "":
+		for _, a := range groupAggregates(p.aggregate, p.groupBy, results) {
+			p.printAggregate(a)
+		}
+		return
+	case p.aggregate != "":
+		p.printAggregate(newAggregate(p.aggregate, results))
+		return
+	}
+
+	var ok []jobResult
+	for _, r := range results {
+		if r.err == nil {
+			ok = append(ok, r)
+		}
+	}
+	if p.multi {
+		sortResults(ok, p.sortBy)
+	}
+	if p.multi && p.format == outputText {
+		p.printTable(ok, len(results))
+		return
+	}
+	for _, r := range ok {
+		p.print(r.res, r.opts)
+	}
+}
+
+// printTable prints the results of several jobs as a column-aligned table
+// followed by their totals, or only the job IDs and desired workers unless
+// verbose. jobs is the number of jobs looked up, including failed ones.
+func (p *printer) printTable(results []jobResult, jobs int) {
+	total := newAggregate(aggregateSum, results)
+	if !p.verbose {
+		for _, r := range results {
+			fmt.Fprintf(p.w, "%s\t%d\n", r.res.JobID, r.res.DesiredWorkers)
+		}
+		fmt.Fprintf(p.w, "total\t%d\n", total.DesiredWorkers)
+		return
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tLOCATION\tJOB ID\tNAME\tTYPE\tSTATE\tCURRENT\tTARGET\tDESIRED")
+	for _, r := range results {
+		res := r.res
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n",
+			res.ProjectID, res.Location, res.JobID, res.JobName, strings.TrimPrefix(res.JobType, "JOB_TYPE_"), res.JobStatus, res.CurrentWorkers, res.TargetWorkers, res.DesiredWorkers)
+	}
+	fmt.Fprintf(tw, "TOTAL (%d of %d jobs)\t\t\t\t\t\t%d\t%d\t%d\n", total.Jobs, jobs, total.CurrentWorkers, total.TargetWorkers, total.DesiredWorkers)
+	tw.Flush()
+}
+
+func (p *printer) printAggregate(a aggregate) {
+	switch p.format {
+	case outputJSON:
+		if err := json.NewEncoder(p.w).Encode(a); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: encoding result: %v\n", err)
+		}
+	case outputInflux:
+		tags := ",aggregate=" + a.Function
+		if a.Group != "" {
+			tags += ",group=" + influxEscapeTag(a.Group)
+		}
+		fmt.Fprintf(p.w, "%s%s current_workers=%di,target_workers=%di,desired_workers=%di,jobs=%di,failed_jobs=%di %d\n",
+			influxMeasurement, tags, a.CurrentWorkers, a.TargetWorkers, a.DesiredWorkers, a.Jobs, a.FailedJobs, time.Now().UnixNano())
+	default:
+		if !p.verbose && a.Group != "" {
+			fmt.Fprintf(p.w, "%s\t%d\n", a.Group, a.DesiredWorkers)
+			return
+		}
+		if !p.verbose {
+			fmt.Fprintln(p.w, a.DesiredWorkers)
+			return
+		}
+		if a.Group != "" {
+			fmt.Fprintf(p.w, "\n--- %s (%s of %d job(s)) ---\n", a.Group, a.Function, a.Jobs)
+		} else {
+			fmt.Fprintf(p.w, "\n--- Results (%s of %d job(s)) ---\n", a.Function, a.Jobs)
+		}
+		if a.FailedJobs > 0 {
+			fmt.Fprintf(p.w, "Failed Jobs: %d\n", a.FailedJobs)
+		}
+		fmt.Fprintf(p.w, "Current Workers: %d\n", a.CurrentWorkers)
+		fmt.Fprintf(p.w, "Target Workers: %d\n", a.TargetWorkers)
+		fmt.Fprintf(p.w, "Desired Workers: %d\n", a.DesiredWorkers)
+		fmt.Fprintln(p.w, "----------------")
+	}
+}
+
+// influxLine formats res as a single InfluxDB line protocol point, e.g.
+//
+//	dataflow_workers,project_id=p,location=l,job_id=j current_workers=3i,... 1700000000000000000
+func influxLine(res *workercount.Result, ts time.Time) string {
+	var b strings.Builder
+	b.WriteString(influxMeasurement)
+	for _, tag := range [][2]string{
+		{"project_id", res.ProjectID},
+		{"location", res.Location},
+		{"job_id", res.JobID},
+	} {
+		fmt.Fprintf(&b, ",%s=%s", tag[0], influxEscapeTag(tag[1]))
+	}
+	fmt.Fprintf(&b, " current_workers=%di,target_workers=%di,desired_workers=%di,min_workers=%di,max_workers=%di,clamped=%t",
+		res.CurrentWorkers, res.TargetWorkers, res.DesiredWorkers, res.MinWorkers, res.MaxWorkers, res.Clamped)
+	if res.JobStatus != "N/A" {
+		fmt.Fprintf(&b, ",job_status=%q", res.JobStatus)
+	}
+	if res.StatWorkers != nil {
+		fmt.Fprintf(&b, ",%s_workers=%g", res.Stat, *res.StatWorkers)
+	}
+	if res.Trend != "" {
+		fmt.Fprintf(&b, ",trend=%q", res.Trend)
+	}
+	if res.WorkersPerMinute != nil {
+		fmt.Fprintf(&b, ",workers_per_minute=%g", *res.WorkersPerMinute)
+	}
+	if res.WatermarkAgeSeconds != nil {
+		fmt.Fprintf(&b, ",watermark_age_seconds=%g", *res.WatermarkAgeSeconds)
+	}
+	if r := res.Resources; r != nil {
+		fmt.Fprintf(&b, ",total_vcpus=%di,total_memory_gb=%g", r.TotalVCPUs, r.TotalMemoryGB)
+	}
+	if res.GPUs != nil {
+		fmt.Fprintf(&b, ",total_gpus=%di", res.GPUs.Total)
+	}
+	if res.Cost != nil {
+		fmt.Fprintf(&b, ",estimated_hourly_cost=%g,over_budget=%t", res.Cost.Hourly, res.OverBudget)
+		if w := res.Cost.Window; w != nil {
+			fmt.Fprintf(&b, ",window_worker_hours=%g,window_cost=%g", w.WorkerHours, w.Cost)
+		}
+	}
+	if n := res.Instances; n != nil {
+		fmt.Fprintf(&b, ",running_instances=%di,instances_diverged=%t", n.Running, n.Diverged)
+	}
+	if len(res.Quotas) > 0 {
+		sufficient := true
+		for _, q := range res.Quotas {
+			sufficient = sufficient && q.Sufficient
+		}
+		fmt.Fprintf(&b, ",quota_sufficient=%t", sufficient)
+	}
+	if res.CPU != nil {
+		fmt.Fprintf(&b, ",cpu_utilization_mean=%g,cpu_utilization_max=%g", res.CPU.Mean, res.CPU.Max)
+	}
+	if m := res.Metrics; m != nil {
+		if m.SystemLagSeconds != nil {
+			fmt.Fprintf(&b, ",system_lag_seconds=%g", *m.SystemLagSeconds)
+		}
+		if m.BacklogBytes != nil {
+			fmt.Fprintf(&b, ",backlog_bytes=%di", *m.BacklogBytes)
+		}
+		if m.BacklogElements != nil {
+			fmt.Fprintf(&b, ",backlog_elements=%di", *m.BacklogElements)
+		}
+		if m.ElementsPerSecond != nil {
+			fmt.Fprintf(&b, ",elements_per_second=%g", *m.ElementsPerSecond)
+		}
+		if m.StreamingEngineComputeUnits != nil {
+			fmt.Fprintf(&b, ",streaming_engine_compute_units=%g", *m.StreamingEngineComputeUnits)
+		}
+		if m.StreamingDataProcessedBytes != nil {
+			fmt.Fprintf(&b, ",streaming_data_processed_bytes=%di", *m.StreamingDataProcessedBytes)
+		}
+	}
+	if res.Messages != nil {
+		fmt.Fprintf(&b, ",error_messages=%di,warning_messages=%di", res.Messages.Errors, res.Messages.Warnings)
+	}
+	fmt.Fprintf(&b, " %d", ts.UnixNano())
+	return b.String()
+}
+
+// yesNo formats b for text output.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// orNA returns s, or "N/A" if empty.
+func orNA(s string) string {
+	if s == "" {
+		return "N/A"
+	}
+	return s
+}
+
+// formatStat formats res.StatWorkers, or "N/A" if no event reported a
+// worker count.
+func formatStat(res *workercount.Result) string {
+	if res.StatWorkers == nil {
+		return "N/A"
+	}
+	return strconv.FormatFloat(*res.StatWorkers, 'f', -1, 64)
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func influxEscapeTag(v string) string {
+	return influxTagEscaper.Replace(v)
+}
+
+// writeFileAtomic replaces the file at path with data by renaming a
+// temporary file in the same directory over it, so readers see either the
+// old or the new content, never part of it.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// CreateTemp creates files only readable by their owner.
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
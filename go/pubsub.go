@@ -0,0 +1,69 @@
+package main
+
+import (
+	"cloud.google.com/go/pubsub/v2"
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/option"
+	"time"
+)
+
+// changeMessage is the JSON payload published when the desired worker count changes.
+type changeMessage struct {
+	*workercount.Result
+	// PreviousDesiredWorkers is omitted for the first observation.
+	PreviousDesiredWorkers *int64    `json:"previous_desired_workers,omitempty"`
+	ObservedAt             time.Time `json:"observed_at"`
+}
+
+// pubSubSink publishes a changeMessage to a topic on the first poll and
+// whenever the desired worker count differs from the previous poll.
+type pubSubSink struct {
+	client    *pubsub.Client
+	publisher *pubsub.Publisher
+}
+
+// newPubSubSink creates a publisher for topic, which is either a topic ID in
+// projectID or a full "projects/P/topics/T" resource name.
+func newPubSubSink(ctx context.Context, projectID, topic string, opts ...option.ClientOption) (*pubSubSink, error) {
+	client, err := pubsub.NewClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &pubSubSink{client: client, publisher: client.Publisher(topic)}, nil
+}
+
+func (s *pubSubSink) Send(ctx context.Context, prev, cur *workercount.Result) error {
+	if prev != nil && prev.DesiredWorkers == cur.DesiredWorkers {
+		return nil
+	}
+
+	msg := changeMessage{Result: cur, ObservedAt: time.Now().UTC()}
+	if prev != nil {
+		msg.PreviousDesiredWorkers = &prev.DesiredWorkers
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.publisher.Publish(ctx, &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"project_id": cur.ProjectID,
+			"location":   cur.Location,
+			"job_id":     cur.JobID,
+		},
+	}).Get(ctx)
+	if err != nil {
+		return fmt.Errorf("publishing to %s: %w", s.publisher, err)
+	}
+	return nil
+}
+
+func (s *pubSubSink) Close() error {
+	s.publisher.Stop()
+	return s.client.Close()
+}
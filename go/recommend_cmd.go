@@ -0,0 +1,92 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runRecommend implements the "recommend" subcommand: it samples the job's
+// metrics twice and suggests a worker count from its backlog growth and
+// throughput per worker.
+func runRecommend(args []string) {
+	fs := flag.NewFlagSet("recommend", flag.ExitOnError)
+	jf := registerJobFlags(fs)
+	sampleInterval := fs.Duration("sample_interval", time.Minute, "Optional: Time between the two samples of the job metrics the backlog growth and throughput are measured over.")
+	drainTime := fs.Duration("drain_time", workercount.DefaultDrainTime, "Optional: Time the current backlog should be processed in, on top of the incoming elements.")
+	targetUtilization := fs.Float64("target_utilization", workercount.DefaultTargetUtilization, "Optional: Fraction of the measured throughput per worker to plan for, leaving headroom for spikes.")
+	output := fs.String("output", outputText, "Optional: Output format: 'text' or 'json'.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s recommend [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Suggests a worker count for a streaming job from its backlog growth, throughput per worker and current workers:\n")
+		fmt.Fprint(os.Stderr, "ceil((throughput + backlog growth + backlog / --drain_time) / (throughput per worker * --target_utilization)),\n")
+		fmt.Fprint(os.Stderr, "clamped by --min_worker and --max_worker.\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+
+	jf.validate(fs)
+	jf.requireSingleJob("recommend")
+	params := workercount.RecommendParams{
+		DrainTime:         *drainTime,
+		TargetUtilization: *targetUtilization,
+		MinWorkers:        jf.minWorker,
+		MaxWorkers:        jf.maxWorker,
+	}
+	if err := params.Validate(); err != nil {
+		exitf(exitUsage, "--%v.", err)
+	}
+	if *sampleInterval <= 0 {
+		exitf(exitUsage, "--sample_interval (%v) must be positive.", *sampleInterval)
+	}
+	if *output != outputText && *output != outputJSON {
+		exitf(exitUsage, "--output must be %q or %q, got %q.", outputText, outputJSON, *output)
+	}
+
+	ctx, cancel := jf.context()
+	defer cancel()
+	client := jf.newClient(ctx)
+	defer client.Close()
+
+	opts := jf.options()
+	res, err := client.Fetch(ctx, opts)
+	exitOnFetchError(err, opts)
+	before, err := client.JobMetrics(ctx, res.ProjectID, res.Location, res.JobID)
+	if err != nil {
+		exitWithError(err)
+	}
+	if *output == outputText {
+		fmt.Printf("Sampling the job metrics for %v...\n", *sampleInterval)
+	}
+	select {
+	case <-time.After(*sampleInterval):
+	case <-ctx.Done():
+		exitWithError(ctx.Err())
+	}
+	after, err := client.JobMetrics(ctx, res.ProjectID, res.Location, res.JobID)
+	if err != nil {
+		exitWithError(err)
+	}
+	r, err := workercount.Recommend(res.CurrentWorkers, before, after, params)
+	if err != nil {
+		exitf(exitUnexpectedState, "Cannot recommend a worker count for job %s: %v.", res.JobID, err)
+	}
+
+	if *output == outputJSON {
+		json.NewEncoder(os.Stdout).Encode(r)
+		return
+	}
+	fmt.Printf("Current Workers: %d\n", r.CurrentWorkers)
+	fmt.Printf("Throughput Per Worker: %.1f elements/s\n", r.ThroughputPerWorker)
+	fmt.Printf("Backlog: %d elements (%+.1f/s)\n", r.BacklogElements, r.BacklogGrowthPerSecond)
+	fmt.Printf("Required Throughput: %.1f elements/s\n", r.RequiredThroughput)
+	if r.Clamped {
+		fmt.Printf("Recommended Workers: %d (clamped by --min_worker/--max_worker)\n", r.RecommendedWorkers)
+	} else {
+		fmt.Printf("Recommended Workers: %d\n", r.RecommendedWorkers)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// defaultListenAddr honours $PORT so "serve" works unchanged on Cloud Run.
+func defaultListenAddr(fallback string) string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return fallback
+}
+
+// runServe implements the "serve" subcommand: the same JSON endpoint as the
+// Cloud Function, for running as a standalone server.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listenAddr := fs.String("listen_addr", defaultListenAddr(":8080"), "Optional: Address to listen on. Defaults to :$PORT when set, otherwise :8080.")
+	bf := registerBreakerFlags(fs)
+	cacheTTL := fs.Duration("cache_ttl", 0, "Optional: How long the result of a request is reused for later requests with the same query parameters, e.g. '30s', so clients polling aggressively do not all hit the API. Defaults to no caching.")
+	cf := registerClientFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Serves GET /?project_id=...&location=...&job_id=... returning the JSON result.\n")
+		fmt.Fprint(os.Stderr, "Query parameters mirror the 'get' flags.\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+	breaker := bf.breaker()
+	if *cacheTTL < 0 {
+		exitf(exitUsage, "--cache_ttl (%v) cannot be negative.", *cacheTTL)
+	}
+	var cache *workercount.Cache
+	if *cacheTTL > 0 {
+		cache = workercount.NewCache(*cacheTTL)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	// The client is shared by all requests for as long as the server runs.
+	cf.longRunning = true
+	client := cf.newClient(ctx)
+	defer client.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", &workercount.Handler{Client: client, Breaker: breaker, Cache: cache})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	log.Printf("Listening on %s", *listenAddr)
+	if err := listenAndServe(ctx, *listenAddr, mux); err != nil {
+		exitWithError(err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout bounds the time serve and export wait for in-flight
+// requests once interrupted.
+const shutdownTimeout = 10 * time.Second
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM, with a
+// cause wrapping errInterrupted, and sets runCtx to it. Once a signal was
+// received, a second one terminates the process right away.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-signals:
+			cancel(fmt.Errorf("%w by signal %v", errInterrupted, s))
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	runCtx = ctx
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// listenAndServe serves handler on addr until ctx is cancelled, then stops
+// accepting connections and waits for in-flight requests to complete.
+func listenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	log.Printf("Shutting down: %v", context.Cause(ctx))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
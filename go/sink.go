@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// sink receives the result of every run or watch poll.
+type sink interface {
+	// Send handles cur. prev is the result of the previous successful poll,
+	// or nil on the first one, so sinks can react to changes only.
+	Send(ctx context.Context, prev, cur *workercount.Result) error
+	Close() error
+}
+
+// errorObserver is implemented by sinks that also track failed polls.
+type errorObserver interface {
+	ObserveError(ctx context.Context, opts workercount.Options, err error)
+}
+
+// observeError reports a failed poll to every sink interested in failures.
+func observeError(ctx context.Context, sinks []sink, opts workercount.Options, err error) {
+	for _, s := range sinks {
+		if o, ok := s.(errorObserver); ok {
+			o.ObserveError(ctx, opts, err)
+		}
+	}
+}
+
+// sendToSinks forwards a result to every sink, logging failures so that one
+// broken destination does not stop the others.
+func sendToSinks(ctx context.Context, sinks []sink, prev, cur *workercount.Result) {
+	for _, s := range sinks {
+		if err := s.Send(ctx, prev, cur); err != nil {
+			log.Printf("WARN: %v", err)
+		}
+	}
+}
+
+func closeSinks(sinks []sink) {
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			log.Printf("WARN: %v", err)
+		}
+	}
+}
+
+// sinkFlags are the flags selecting where results are sent besides stdout.
+type sinkFlags struct {
+	publishTopic         string
+	slackWebhookURL      string
+	webhookURL           string
+	webhookHeaders       stringList
+	webhookRetries       int
+	writeMetric          bool
+	statsdAddr           string
+	statsdPrefix         string
+	statsdTags           bool
+	otel                 bool
+	bigqueryTable        string
+	gcsOutput            string
+	gcsIfGenerationMatch int64
+	historyDB            string
+	historyFile          string
+	historyMaxSizeMB     int64
+	historyMaxAge        time.Duration
+	historyMaxBackups    int
+	dumpEvents           string
+}
+
+func registerSinkFlags(fs *flag.FlagSet) *sinkFlags {
+	f := &sinkFlags{}
+	fs.StringVar(&f.publishTopic, "publish_topic", "", "Optional: Pub/Sub topic ID (in --project_id) or full 'projects/P/topics/T' name. A JSON message is published on the first poll and whenever the desired worker count changes.")
+	fs.StringVar(&f.slackWebhookURL, "slack_webhook_url", "", "Optional: Slack incoming webhook URL notified when desired workers change, get clamped by --min_worker/--max_worker, exceed --max_hourly_cost, or the job leaves JOB_STATE_RUNNING (requires --fetch_job_status).")
+	fs.StringVar(&f.webhookURL, "webhook_url", "", "Optional: HTTPS endpoint that receives the JSON result via POST on every run or poll.")
+	fs.Var(&f.webhookHeaders, "webhook_header", "Optional: Extra 'Name: value' header sent with --webhook_url requests. May be repeated.")
+	fs.IntVar(&f.webhookRetries, "webhook_retries", 3, "Optional: Number of retries with exponential backoff for failed --webhook_url requests.")
+	fs.BoolVar(&f.writeMetric, "write_metric", false, "Optional: Write the desired worker count to Cloud Monitoring as custom.googleapis.com/dataflow/desired_workers in --project_id.")
+	fs.StringVar(&f.statsdAddr, "statsd_addr", "", "Optional: StatsD 'host:port' to send current/target/desired worker gauges to over UDP on every run or poll.")
+	fs.StringVar(&f.statsdPrefix, "statsd_prefix", "dataflow", "Optional: Metric name prefix for --statsd_addr.")
+	fs.BoolVar(&f.statsdTags, "statsd_tags", false, "Optional: Identify the job with DogStatsD tags instead of embedding it in the metric name.")
+	fs.BoolVar(&f.otel, "otel", false, "Optional: Export worker gauges and poll counters with OpenTelemetry over OTLP, configured via the standard OTEL_EXPORTER_OTLP_* environment variables.")
+	fs.StringVar(&f.bigqueryTable, "bigquery_table", "", "Optional: BigQuery table ('project.dataset.table' or 'dataset.table' in --project_id) to append every observation to. Created if missing.")
+	fs.StringVar(&f.gcsOutput, "gcs_output", "", "Optional: 'gs://bucket/path.json' object to upload the JSON result to on every run or poll.")
+	fs.Int64Var(&f.gcsIfGenerationMatch, "gcs_if_generation_match", -1, "Optional: Only upload --gcs_output if the object's generation matches (0 = object must not exist). Later polls then require the generation of the previous upload. Disabled when negative.")
+	fs.StringVar(&f.historyDB, "history_db", "", "Optional: Path to a local SQLite database that records every observation. Query it with the 'history' subcommand.")
+	fs.StringVar(&f.historyFile, "history_file", "", "Optional: File to append every observation to as a JSON line (observed_at, project_id, location, job_id, current, target and desired workers, state), as a lightweight audit trail of what the tool reported and when.")
+	fs.Int64Var(&f.historyMaxSizeMB, "history_max_size_mb", 100, "Optional: Size in megabytes after which --history_file is rotated, renamed with the rotation time as a suffix. 0 disables size-based rotation.")
+	fs.DurationVar(&f.historyMaxAge, "history_max_age", 0, "Optional: Age of the first observation in --history_file after which it is rotated, e.g. '24h'. Defaults to no age-based rotation.")
+	fs.IntVar(&f.historyMaxBackups, "history_max_backups", 5, "Optional: Number of rotated --history_file backups kept, removing the oldest. 0 keeps them all.")
+	fs.StringVar(&f.dumpEvents, "dump_events", "", "Optional: File to append every autoscaling event considered in the window to as JSON lines (job_id, time, type, current and target workers, description), or '-' for stdout.")
+	return f
+}
+
+// open creates the selected sinks, exiting if any cannot be set up.
+func (f *sinkFlags) open(ctx context.Context, jf *jobFlags) []sink {
+	opts := jf.clientOptions()
+	var sinks []sink
+	if f.publishTopic != "" {
+		ps, err := newPubSubSink(ctx, jf.primaryProject(), f.publishTopic, opts...)
+		if err != nil {
+			exitWithError(fmt.Errorf("Failed to create Pub/Sub publisher: %w", err))
+		}
+		sinks = append(sinks, ps)
+	}
+	if f.slackWebhookURL != "" {
+		sinks = append(sinks, newSlackSink(f.slackWebhookURL))
+	}
+	if f.webhookURL != "" {
+		ws, err := newWebhookSink(f.webhookURL, f.webhookHeaders, f.webhookRetries)
+		if err != nil {
+			exitf(exitUsage, "%v.", err)
+		}
+		sinks = append(sinks, ws)
+	}
+	if f.statsdAddr != "" {
+		ss, err := newStatsdSink(f.statsdAddr, f.statsdPrefix, f.statsdTags)
+		if err != nil {
+			exitf(exitUsage, "%v.", err)
+		}
+		sinks = append(sinks, ss)
+	}
+	if f.otel {
+		ot, err := newOtelSink(ctx)
+		if err != nil {
+			exitWithError(fmt.Errorf("Failed to set up OpenTelemetry: %w", err))
+		}
+		sinks = append(sinks, ot)
+	}
+	if f.bigqueryTable != "" {
+		bs, err := newBigQuerySink(ctx, jf.primaryProject(), f.bigqueryTable, opts...)
+		if err != nil {
+			exitWithError(fmt.Errorf("Failed to set up BigQuery: %w", err))
+		}
+		sinks = append(sinks, bs)
+	}
+	if f.gcsOutput != "" {
+		gs, err := newGCSSink(ctx, f.gcsOutput, f.gcsIfGenerationMatch, opts...)
+		if err != nil {
+			exitWithError(fmt.Errorf("Failed to set up GCS output: %w", err))
+		}
+		sinks = append(sinks, gs)
+	}
+	if f.historyDB != "" {
+		store, err := openHistoryStore(f.historyDB)
+		if err != nil {
+			exitWithError(err)
+		}
+		sinks = append(sinks, &historySink{store: store})
+	}
+	if f.historyFile != "" {
+		if f.historyMaxSizeMB < 0 || f.historyMaxAge < 0 || f.historyMaxBackups < 0 {
+			exitf(exitUsage, "--history_max_size_mb, --history_max_age and --history_max_backups cannot be negative.")
+		}
+		hs, err := newHistoryFileSink(f.historyFile, f.historyMaxSizeMB<<20, f.historyMaxAge, f.historyMaxBackups)
+		if err != nil {
+			exitWithError(err)
+		}
+		sinks = append(sinks, hs)
+	}
+	if f.dumpEvents != "" {
+		ds, err := newEventDumpSink(f.dumpEvents)
+		if err != nil {
+			exitWithError(err)
+		}
+		sinks = append(sinks, ds)
+	}
+	if f.writeMetric {
+		ms, err := newMetricSink(ctx, jf.primaryProject(), opts...)
+		if err != nil {
+			exitWithError(fmt.Errorf("Failed to create Cloud Monitoring client: %w", err))
+		}
+		sinks = append(sinks, ms)
+	}
+	return sinks
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const jobStateRunning = "JOB_STATE_RUNNING"
+
+// slackSink posts to a Slack incoming webhook when the desired worker count
+// changes, when it starts being clamped by --min_worker/--max_worker or
+// exceeding --max_hourly_cost, or when the job enters a state other than
+// JOB_STATE_RUNNING.
+type slackSink struct {
+	webhookURL string
+	client     *http.Client
+}
+
+func newSlackSink(webhookURL string) *slackSink {
+	return &slackSink{webhookURL: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *slackSink) Send(ctx context.Context, prev, cur *workercount.Result) error {
+	lines := slackNotifications(prev, cur)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	text := fmt.Sprintf("Dataflow job `%s` (%s/%s):\n%s", cur.JobID, cur.ProjectID, cur.Location, strings.Join(lines, "\n"))
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting to Slack: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("posting to Slack: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *slackSink) Close() error { return nil }
+
+// slackNotifications returns one line per noteworthy change between prev and cur.
+func slackNotifications(prev, cur *workercount.Result) []string {
+	var lines []string
+	if prev != nil && prev.DesiredWorkers != cur.DesiredWorkers {
+		lines = append(lines, fmt.Sprintf("• Desired workers changed from %d to %d (current %d, target %d).",
+			prev.DesiredWorkers, cur.DesiredWorkers, cur.CurrentWorkers, cur.TargetWorkers))
+	}
+	if cur.Clamped && (prev == nil || !prev.Clamped) {
+		lines = append(lines, fmt.Sprintf("• Desired workers clamped to %d by min %d / max %d (current %d, target %d).",
+			cur.DesiredWorkers, cur.MinWorkers, cur.MaxWorkers, cur.CurrentWorkers, cur.TargetWorkers))
+	}
+	if cur.OverBudget && (prev == nil || !prev.OverBudget) {
+		lines = append(lines, fmt.Sprintf("• Estimated cost of %d workers, $%.2f/hour, exceeds the budget of $%g/hour.",
+			cur.DesiredWorkers, cur.Cost.Hourly, cur.MaxHourlyCost))
+	}
+	// JobStatus is "N/A" unless --fetch_job_status is set.
+	if cur.JobStatus != "N/A" && cur.JobStatus != jobStateRunning && (prev == nil || prev.JobStatus != cur.JobStatus) {
+		lines = append(lines, fmt.Sprintf("• Job entered state %s.", cur.JobStatus))
+	}
+	return lines
+}
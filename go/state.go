@@ -0,0 +1,79 @@
+package main
+
+import (
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// stateFileUsage is the usage of the --state_file flag of get and watch.
+const stateFileUsage = "Optional: JSON file storing the newest autoscaling events found for each job, created if missing, so later runs only scan the messages reported since instead of the whole window. Ignored with --end_time and with options needing every event of the window, like --stat."
+
+// jobState is the state of incremental lookups kept in --state_file.
+type jobState struct {
+	path string
+	// Jobs holds the checkpoint of each job, keyed by stateKey.
+	Jobs map[string]*workercount.Checkpoint `json:"jobs"`
+}
+
+// loadState reads the state file at path, exiting if it is invalid. It
+// returns nil without --state_file.
+func loadState(path string) *jobState {
+	if path == "" {
+		return nil
+	}
+	s := &jobState{path: path, Jobs: map[string]*workercount.Checkpoint{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s
+	}
+	if err == nil {
+		err = json.Unmarshal(data, s)
+	}
+	if err != nil {
+		exitf(exitUsage, "Invalid --state_file %s: %v", path, err)
+	}
+	if s.Jobs == nil {
+		s.Jobs = map[string]*workercount.Checkpoint{}
+	}
+	return s
+}
+
+// stateKey returns the key of the job looked up with opts in the state file.
+func stateKey(opts workercount.Options) string {
+	return opts.ProjectID + "/" + opts.Location + "/" + opts.Job()
+}
+
+// apply resumes the lookups of targets from their checkpoints.
+func (s *jobState) apply(targets []jobTarget) {
+	if s == nil {
+		return
+	}
+	for i := range targets {
+		targets[i].opts.Checkpoint = s.Jobs[stateKey(targets[i].opts)]
+	}
+}
+
+// update records the checkpoints of the successful results and writes the
+// state file.
+func (s *jobState) update(results []jobResult) error {
+	if s == nil {
+		return nil
+	}
+	for _, r := range results {
+		if r.err == nil && r.res.Checkpoint != nil {
+			s.Jobs[stateKey(r.opts)] = r.res.Checkpoint
+		}
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("writing --state_file: %w", err)
+	}
+	return nil
+}
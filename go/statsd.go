@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// statsdSink emits current, target and desired worker gauges over UDP.
+//
+// With DogStatsD tags the job is identified by tags:
+//
+//	dataflow.desired_workers:5|g|#project_id:p,location:l,job_id:j
+//
+// otherwise it is folded into the metric name:
+//
+//	dataflow.p.l.j.desired_workers:5|g
+type statsdSink struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool
+}
+
+func newStatsdSink(addr, prefix string, dogstatsd bool) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --statsd_addr %q: %v", addr, err)
+	}
+	return &statsdSink{conn: conn, prefix: prefix, dogstatsd: dogstatsd}, nil
+}
+
+func (s *statsdSink) Send(_ context.Context, _, cur *workercount.Result) error {
+	name := s.prefix
+	var tags string
+	if s.dogstatsd {
+		tags = fmt.Sprintf("|#project_id:%s,location:%s,job_id:%s", cur.ProjectID, cur.Location, cur.JobID)
+	} else {
+		name = strings.Join([]string{s.prefix, statsdSanitize(cur.ProjectID), statsdSanitize(cur.Location), statsdSanitize(cur.JobID)}, ".")
+	}
+
+	var b strings.Builder
+	for _, g := range []struct {
+		metric string
+		value  int64
+	}{
+		{"current_workers", cur.CurrentWorkers},
+		{"target_workers", cur.TargetWorkers},
+		{"desired_workers", cur.DesiredWorkers},
+	} {
+		fmt.Fprintf(&b, "%s.%s:%d|g%s\n", name, g.metric, g.value, tags)
+	}
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		return fmt.Errorf("sending StatsD gauges: %w", err)
+	}
+	return nil
+}
+
+func (s *statsdSink) Close() error {
+	return s.conn.Close()
+}
+
+var statsdNameReplacer = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_")
+
+// statsdSanitize makes v safe to use as a single StatsD metric name segment.
+func statsdSanitize(v string) string {
+	return statsdNameReplacer.Replace(v)
+}
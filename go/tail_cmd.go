@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tailLine is a job message or autoscaling event printed by the "tail"
+// subcommand.
+type tailLine struct {
+	Time time.Time `json:"time"`
+	// Kind is "message" or "autoscaling".
+	Kind           string `json:"kind"`
+	Importance     string `json:"importance,omitempty"`
+	EventType      string `json:"event_type,omitempty"`
+	CurrentWorkers int64  `json:"current_workers,omitempty"`
+	TargetWorkers  int64  `json:"target_workers,omitempty"`
+	Text           string `json:"text,omitempty"`
+
+	// key identifies the line among those reported at the same time.
+	key string
+}
+
+// runTail implements the "tail" subcommand.
+func runTail(args []string) {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	jf := registerJobFlags(fs)
+	interval := fs.Duration("interval", 10*time.Second, "Optional: How often to poll for new job messages.")
+	output := fs.String("output", outputText, "Optional: Output format: 'text' or 'json' (one object per line).")
+	timezone := fs.String("timezone", "UTC", "Optional: IANA time zone of printed times, e.g. 'America/New_York' or 'Local'.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s tail [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Follows a job's messages and autoscaling events, printing new ones as they are reported, until the job terminates.\n")
+		fmt.Fprint(os.Stderr, "Starts --time_delta_minutes, --lookback or --start_time in the past; by default with new messages only.\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+
+	jf.validate(fs)
+	jf.requireSingleJob("tail")
+	if !jf.endTime.IsZero() {
+		exitf(exitUsage, "--end_time cannot be combined with the tail command.")
+	}
+	if *interval <= 0 {
+		exitf(exitUsage, "--interval (%v) must be positive.", *interval)
+	}
+	if *output != outputText && *output != outputJSON {
+		exitf(exitUsage, "--output must be %q or %q, got %q.", outputText, outputJSON, *output)
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		exitf(exitUsage, "Invalid --timezone: %v", err)
+	}
+
+	ctx, cancel := jf.context()
+	defer cancel()
+	jf.longRunning = true
+	client := jf.newClient(ctx)
+	defer client.Close()
+
+	opts := jf.options()
+	if err := client.ResolveJob(ctx, &opts); err != nil {
+		exitWithError(err)
+	}
+	start, _ := opts.Window(time.Now().UTC())
+	// Like watch, tail stops once --deadline expires or it is interrupted.
+	if err := tail(ctx, client, opts, start, *interval, func(l tailLine) { printTailLine(os.Stdout, l, *output, loc) }); err != nil && runCancelled() == nil {
+		exitWithError(err)
+	}
+}
+
+// tail polls the job every interval for the messages and autoscaling events
+// reported since the newest one seen, starting at start, and passes new ones
+// to emit, oldest first. It returns once the job reached a terminal state and
+// its last messages were emitted. Transient API errors are logged and the
+// next poll proceeds as usual.
+func tail(ctx context.Context, client *workercount.Client, opts workercount.Options, start time.Time, interval time.Duration, emit func(tailLine)) error {
+	// seen holds the keys of the lines reported at start, which the next
+	// poll lists again as the window includes its start.
+	seen := map[string]bool{}
+	for {
+		// The state is checked before listing so the final messages of a
+		// job terminating in between are not missed.
+		state, err := client.JobStatus(ctx, opts.ProjectID, opts.Location, opts.JobID)
+		if err != nil {
+			logError("", err)
+		}
+		messages, events, err := client.ListMessages(ctx, opts, start, time.Time{})
+		if err != nil {
+			logError("", err)
+		} else {
+			lines := tailLines(messages, events)
+			for _, l := range lines {
+				if !l.Time.Equal(start) || !seen[l.key] {
+					emit(l)
+				}
+			}
+			if n := len(lines); n > 0 && lines[n-1].Time.After(start) {
+				start, seen = lines[n-1].Time, map[string]bool{}
+			}
+			for _, l := range lines {
+				if l.Time.Equal(start) {
+					seen[l.key] = true
+				}
+			}
+			if workercount.IsTerminalState(state) {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// tailLines merges messages and events into lines ordered oldest first.
+func tailLines(messages []workercount.Message, events []workercount.Event) []tailLine {
+	lines := make([]tailLine, 0, len(messages)+len(events))
+	for _, m := range messages {
+		lines = append(lines, tailLine{
+			Time:       m.Time,
+			Kind:       "message",
+			Importance: m.Importance,
+			Text:       m.Text,
+			key:        "message:" + m.ID,
+		})
+	}
+	for _, e := range events {
+		lines = append(lines, tailLine{
+			Time:           e.Time,
+			Kind:           "autoscaling",
+			EventType:      e.Type,
+			CurrentWorkers: e.CurrentWorkers,
+			TargetWorkers:  e.TargetWorkers,
+			Text:           e.Description,
+			key:            fmt.Sprintf("autoscaling:%s:%d:%d:%s", e.Type, e.CurrentWorkers, e.TargetWorkers, e.Description),
+		})
+	}
+	sort.SliceStable(lines, func(i, k int) bool { return lines[i].Time.Before(lines[k].Time) })
+	return lines
+}
+
+// printTailLine prints l as text or a line of JSON.
+func printTailLine(w io.Writer, l tailLine, format string, loc *time.Location) {
+	if format == outputJSON {
+		if err := json.NewEncoder(w).Encode(l); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: encoding line: %v\n", err)
+		}
+		return
+	}
+	at := l.Time.In(loc).Format(time.RFC3339)
+	if l.Kind == "autoscaling" {
+		fmt.Fprintf(w, "%s  AUTOSCALING  %s current=%d target=%d  %s\n", at, l.EventType, l.CurrentWorkers, l.TargetWorkers, l.Text)
+		return
+	}
+	fmt.Fprintf(w, "%s  %-11s  %s\n", at, strings.TrimPrefix(l.Importance, "JOB_MESSAGE_"), l.Text)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"dataflow_worker_count/workercount"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// multiJob reports whether the flags select any number of jobs rather than
+// exactly one.
+func (f *jobFlags) multiJob() bool {
+	return len(f.jobIDs.stringList) > 1 || f.jobsFile != "" || f.listsJobs()
+}
+
+// listsJobs reports whether the jobs are selected from the active jobs
+// listed in the selected locations.
+func (f *jobFlags) listsJobs() bool {
+	return f.allJobs || f.jobNamePattern != "" || f.jobNameGlob != "" || len(f.labels) > 0
+}
+
+// requireSingleJob exits if the flags select several jobs, for commands
+// that only handle one.
+func (f *jobFlags) requireSingleJob(command string) {
+	if f.multiJob() {
+		exitf(exitUsage, "The %s command takes a single job: use --job_id or --job_name.", command)
+	}
+}
+
+// Supported --job_type values.
+const (
+	jobTypeBatch     = "batch"
+	jobTypeStreaming = "streaming"
+)
+
+// jobMatcher returns the predicate selecting jobs by --job_name_pattern,
+// --job_name_glob, --label and --job_type. Without any of them, as with
+// --all_jobs, every job matches.
+func (f *jobFlags) jobMatcher() (func(workercount.JobSummary) bool, error) {
+	nameMatches := func(string) bool { return true }
+	switch {
+	case f.jobNamePattern != "":
+		re, err := regexp.Compile("^(?:" + f.jobNamePattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid --job_name_pattern: %w", err)
+		}
+		nameMatches = re.MatchString
+	case f.jobNameGlob != "":
+		if _, err := path.Match(f.jobNameGlob, ""); err != nil {
+			return nil, fmt.Errorf("invalid --job_name_glob: %w", err)
+		}
+		nameMatches = func(name string) bool {
+			ok, _ := path.Match(f.jobNameGlob, name)
+			return ok
+		}
+	}
+
+	labels := map[string]string{}
+	for _, l := range f.labels {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid --label %q: expected 'key=value'", l)
+		}
+		labels[k] = v
+	}
+
+	jobType := ""
+	if f.jobType != "" {
+		jobType = "JOB_TYPE_" + strings.ToUpper(f.jobType)
+	}
+
+	return func(j workercount.JobSummary) bool {
+		if jobType != "" && j.Type != jobType {
+			return false
+		}
+		for k, v := range labels {
+			if got, ok := j.Labels[k]; !ok || got != v {
+				return false
+			}
+		}
+		return nameMatches(j.Name)
+	}, nil
+}
+
+// jobTarget is a job selected for lookup.
+type jobTarget struct {
+	opts workercount.Options
+	// labels are the job's Dataflow labels and jobType its type, known when
+	// the job was selected from the listed active jobs.
+	labels  map[string]string
+	jobType string
+}
+
+// targets resolves the jobs selected by the flags to lookups. Multi-job
+// selectors are resolved against the active jobs on every call, so jobs
+// launched later are picked up by long-running commands.
+func (f *jobFlags) targets(ctx context.Context, client *workercount.Client) ([]jobTarget, error) {
+	if !f.multiJob() {
+		return []jobTarget{{opts: f.options()}}, nil
+	}
+	targets, err := f.multiJobTargets(ctx, client)
+	if err != nil || !f.skipFlexRS {
+		return targets, err
+	}
+	return skipFlexRS(ctx, client, targets), nil
+}
+
+// skipFlexRS drops the FlexRS jobs from targets. Jobs whose goal cannot be
+// determined are kept, so their lookup reports the failure.
+func skipFlexRS(ctx context.Context, client *workercount.Client, targets []jobTarget) []jobTarget {
+	var kept []jobTarget
+	for _, t := range targets {
+		goal, err := client.FlexRSGoal(ctx, t.opts.ProjectID, t.opts.Location, t.opts.JobID)
+		if err != nil {
+			log.Printf("WARN: job %s: %v", t.opts.Job(), err)
+		}
+		if goal == "" {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// multiJobTargets resolves the jobs selected by multi-job selectors.
+func (f *jobFlags) multiJobTargets(ctx context.Context, client *workercount.Client) ([]jobTarget, error) {
+	if f.jobsFile != "" {
+		targets := make([]jobTarget, len(f.fileTargets))
+		for i, opts := range f.fileTargets {
+			targets[i] = jobTarget{opts: opts}
+		}
+		return targets, nil
+	}
+	if len(f.jobIDs.stringList) > 1 {
+		var targets []jobTarget
+		for _, id := range f.jobIDs.stringList {
+			opts := f.options()
+			opts.JobID = id
+			targets = append(targets, jobTarget{opts: opts})
+		}
+		return targets, nil
+	}
+	match, err := f.jobMatcher()
+	if err != nil {
+		return nil, err
+	}
+	locations := f.locations()
+	if f.allLocations {
+		// An empty location lists the jobs in every location.
+		locations = []string{""}
+	}
+	var jobs []workercount.JobSummary
+	for _, project := range f.projects {
+		for _, location := range locations {
+			found, err := client.ListJobs(ctx, project, location, workercount.JobFilterActive)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, found...)
+		}
+	}
+
+	var targets []jobTarget
+	for _, j := range jobs {
+		if !match(j) {
+			continue
+		}
+		opts := f.options()
+		opts.ProjectID = j.ProjectID
+		opts.Location = j.Location
+		opts.JobID = j.ID
+		opts.JobName = j.Name
+		targets = append(targets, jobTarget{opts: opts, labels: j.Labels, jobType: j.Type})
+	}
+	return targets, nil
+}
+
+// readJobsFile reads newline-delimited "project,location,job_id" lines from
+// path, or stdin for "-", into lookups based on base.
+func readJobsFile(path string, base workercount.Options) ([]workercount.Options, error) {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var targets []workercount.Options
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected 'project,location,job_id', got %q", path, n, line)
+		}
+		opts := base
+		opts.ProjectID = strings.TrimSpace(fields[0])
+		opts.Location = strings.TrimSpace(fields[1])
+		opts.JobID = strings.TrimSpace(fields[2])
+		if err := opts.Validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		targets = append(targets, opts)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s lists no jobs", path)
+	}
+	return targets, nil
+}
+
+// readProjectsFile reads newline-delimited project IDs from path, or stdin
+// for "-".
+func readProjectsFile(path string) ([]string, error) {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var projects []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			projects = append(projects, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("%s lists no projects", path)
+	}
+	return projects, nil
+}
+
+// jobResult is the outcome of looking up one of the targeted jobs.
+type jobResult struct {
+	jobTarget
+	res *workercount.Result
+	err error
+}
+
+// fetchTargets looks up every target, at most concurrency at a time. Results
+// are returned in the order of targets. Failures are recorded in the
+// corresponding jobResult so one broken job does not hide the others.
+func fetchTargets(ctx context.Context, client *workercount.Client, targets []jobTarget, concurrency int, p *printer) []jobResult {
+	results := make([]jobResult, len(targets))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res, err := fetch(ctx, client, t.opts, p)
+			if err == nil && res.JobType == "" {
+				res.JobType = t.jobType
+			}
+			results[i] = jobResult{jobTarget: t, res: res, err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
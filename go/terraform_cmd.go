@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// runTerraform implements the Terraform external program protocol, so the
+// tool can be used as a `data "external"` source:
+//
+//	data "external" "dataflow_workers" {
+//	  program = ["./dataflow_worker_count", "terraform"]
+//	  query = {
+//	    project_id = "my-project"
+//	    location   = "us-central1"
+//	    job_id     = "my-job"
+//	  }
+//	}
+//
+// The query object is read from stdin; its keys are the HTTP handler
+// parameters plus credentials_path. A flat string map result is written to
+// stdout. Errors go to stderr with a non-zero exit status, as the protocol
+// requires.
+func runTerraform(args []string) {
+	fs := flag.NewFlagSet("terraform", flag.ExitOnError)
+	parseFlags(fs, args)
+	if fs.NArg() > 0 {
+		terraformFail(fmt.Errorf("the terraform subcommand takes no arguments; pass parameters through the query object"))
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		terraformFail(fmt.Errorf("reading query: %w", err))
+	}
+	var query map[string]string
+	if err := json.Unmarshal(data, &query); err != nil {
+		terraformFail(fmt.Errorf("parsing query: %w", err))
+	}
+
+	values := url.Values{}
+	for k, v := range query {
+		values.Set(k, v)
+	}
+	opts, err := workercount.ParseOptions(values)
+	if err != nil {
+		terraformFail(err)
+	}
+	if err := opts.Validate(); err != nil {
+		terraformFail(err)
+	}
+
+	ctx := context.Background()
+	client, err := workercount.NewClient(ctx, credentialsOptions(query["credentials_path"])...)
+	if err != nil {
+		terraformFail(err)
+	}
+	defer client.Close()
+
+	res, err := client.Fetch(ctx, opts)
+	if err != nil {
+		terraformFail(err)
+	}
+
+	// Terraform requires every result value to be a string.
+	json.NewEncoder(os.Stdout).Encode(map[string]string{
+		"project_id":      res.ProjectID,
+		"location":        res.Location,
+		"job_id":          res.JobID,
+		"job_status":      res.JobStatus,
+		"current_workers": strconv.FormatInt(res.CurrentWorkers, 10),
+		"target_workers":  strconv.FormatInt(res.TargetWorkers, 10),
+		"min_workers":     strconv.FormatInt(res.MinWorkers, 10),
+		"max_workers":     strconv.FormatInt(res.MaxWorkers, 10),
+		"desired_workers": strconv.FormatInt(res.DesiredWorkers, 10),
+		"clamped":         strconv.FormatBool(res.Clamped),
+	})
+}
+
+func terraformFail(err error) {
+	fmt.Fprintf(os.Stderr, "dataflow_worker_count: %v\n", err)
+	os.Exit(1)
+}
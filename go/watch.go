@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"dataflow_worker_count/workercount"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// runWatch implements the "watch" subcommand.
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	jf := registerJobFlags(fs)
+	of := registerOutputFlags(fs)
+	sf := registerSinkFlags(fs)
+	interval := fs.Duration("interval", time.Minute, "Optional: How often to poll the job.")
+	stateFile := fs.String("state_file", "", stateFileUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s watch [flags]\n", os.Args[0])
+		fmt.Fprint(os.Stderr, "Polls a Dataflow job's worker counts, printing each result and sending it to the configured sinks.\n\n")
+		fs.PrintDefaults()
+		printPrerequisites()
+	}
+	parseFlags(fs, args)
+
+	jf.includeEvents = (of.chart && of.output == outputText) || sf.dumpEvents != ""
+	jf.longRunning = true
+	jf.validate(fs)
+	if *interval <= 0 {
+		exitf(exitUsage, "--interval (%v) must be positive.", *interval)
+	}
+	p := of.printer()
+	state := loadState(*stateFile)
+
+	ctx, cancel := jf.context()
+	defer cancel()
+	client := jf.newClient(ctx)
+	defer client.Close()
+	sinks := sf.open(ctx, jf)
+	defer closeSinks(sinks)
+
+	p.multi = jf.multiJob()
+	watch(ctx, client, jf, *interval, p, sinks, state)
+}
+
+// watch polls the selected jobs every interval until ctx is cancelled,
+// printing each result and forwarding it to sinks. Errors are logged and the
+// next poll proceeds as usual. With a state, every poll resumes the scans
+// of the previous one.
+func watch(ctx context.Context, client *workercount.Client, jf *jobFlags, interval time.Duration, p *printer, sinks []sink, state *jobState) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// prev holds the previous result of each job, keyed by the job ID or
+	// --job_name given, so a job relaunched under the same name is compared
+	// with its predecessor.
+	prev := map[string]*workercount.Result{}
+	for {
+		targets, err := jf.targets(ctx, client)
+		if err != nil && ctx.Err() == nil {
+			logError("", err)
+			observeError(ctx, sinks, jf.options(), err)
+		}
+		state.apply(targets)
+		results := fetchTargets(ctx, client, targets, jf.concurrency, p)
+		if ctx.Err() != nil {
+			// The poll was cut short by a signal or --deadline; what was
+			// sent to the sinks so far is flushed as they are closed.
+			return
+		}
+		if err := state.update(results); err != nil {
+			log.Printf("WARN: %v", err)
+		}
+		for _, r := range results {
+			if r.err != nil {
+				logError(r.opts.Job(), r.err)
+				observeError(ctx, sinks, r.opts, r.err)
+				continue
+			}
+			warnIfStale(r.res, r.opts)
+			warnIfQuotaInsufficient(r.res)
+			warnIfInstancesDiverge(r.res)
+			warnIfOverBudget(r.res)
+			sendToSinks(ctx, sinks, prev[r.opts.Job()], r.res)
+			prev[r.opts.Job()] = r.res
+		}
+		if err := p.printResults(results); err != nil {
+			logError("", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
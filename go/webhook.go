@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"dataflow_worker_count/workercount"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webhookSink POSTs every result as JSON to an HTTPS endpoint, retrying
+// network errors, 429 and 5xx responses with exponential backoff.
+type webhookSink struct {
+	url     string
+	headers http.Header
+	retries int
+	client  *http.Client
+}
+
+// newWebhookSink validates rawURL and headers, each given as "Name: value".
+// Plain http is only accepted for loopback hosts.
+func newWebhookSink(rawURL string, headers []string, retries int) (*webhookSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --webhook_url: %v", err)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		return nil, fmt.Errorf("--webhook_url must use https, got %q", rawURL)
+	}
+	if retries < 0 {
+		return nil, fmt.Errorf("--webhook_retries (%d) cannot be negative", retries)
+	}
+
+	h := http.Header{}
+	for _, kv := range headers {
+		name, value, ok := strings.Cut(kv, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --webhook_header %q, expected 'Name: value'", kv)
+		}
+		h.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	h.Set("Content-Type", "application/json")
+
+	return &webhookSink{url: rawURL, headers: h, retries: retries, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *webhookSink) Send(ctx context.Context, _, cur *workercount.Result) error {
+	body, err := json.Marshal(cur)
+	if err != nil {
+		return err
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retryable, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= s.retries {
+			return fmt.Errorf("posting to webhook after %d attempt(s): %w", attempt+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes a single request, reporting whether a failure is worth retrying.
+func (s *webhookSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header = s.headers.Clone()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+func (s *webhookSink) Close() error { return nil }
@@ -0,0 +1,80 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"strconv"
+	"strings"
+)
+
+// AutoscalingOptions are the pipeline options of a job governing its
+// autoscaling, the configured limits to compare the observed counts with.
+type AutoscalingOptions struct {
+	NumWorkers    int64 `json:"num_workers,omitempty"`
+	MaxNumWorkers int64 `json:"max_num_workers,omitempty"`
+	// AutoscalingAlgorithm is e.g. "THROUGHPUT_BASED" or "NONE".
+	AutoscalingAlgorithm string `json:"autoscaling_algorithm,omitempty"`
+	WorkerMachineType    string `json:"worker_machine_type,omitempty"`
+}
+
+// autoscalingOptionNames are the names of each option in the pipeline
+// options of the Java and Python SDKs.
+var autoscalingOptionNames = struct {
+	numWorkers, maxNumWorkers, algorithm, machineType []string
+}{
+	numWorkers:    []string{"numWorkers", "num_workers"},
+	maxNumWorkers: []string{"maxNumWorkers", "max_num_workers"},
+	algorithm:     []string{"autoscalingAlgorithm", "autoscaling_algorithm"},
+	machineType:   []string{"workerMachineType", "worker_machine_type", "machine_type"},
+}
+
+// autoscalingOptions returns the autoscaling options of job from its
+// pipeline options, completed from its worker pool of kind, as selected by
+// workerPool, for options left to the service.
+func autoscalingOptions(job *dataflowpb.Job, kind string) *AutoscalingOptions {
+	fields := job.GetEnvironment().GetSdkPipelineOptions().GetFields()["options"].GetStructValue().GetFields()
+	names := autoscalingOptionNames
+	o := &AutoscalingOptions{
+		NumWorkers:           pipelineInt(fields, names.numWorkers),
+		MaxNumWorkers:        pipelineInt(fields, names.maxNumWorkers),
+		AutoscalingAlgorithm: pipelineString(fields, names.algorithm),
+		WorkerMachineType:    pipelineString(fields, names.machineType),
+	}
+
+	pool := workerPool(job, kind)
+	if o.NumWorkers == 0 {
+		o.NumWorkers = int64(pool.GetNumWorkers())
+	}
+	if o.MaxNumWorkers == 0 {
+		o.MaxNumWorkers = int64(pool.GetAutoscalingSettings().GetMaxNumWorkers())
+	}
+	if algorithm := pool.GetAutoscalingSettings().GetAlgorithm(); o.AutoscalingAlgorithm == "" && algorithm != dataflowpb.AutoscalingAlgorithm_AUTOSCALING_ALGORITHM_UNKNOWN {
+		o.AutoscalingAlgorithm = strings.TrimPrefix(algorithm.String(), "AUTOSCALING_ALGORITHM_")
+	}
+	if o.WorkerMachineType == "" {
+		o.WorkerMachineType = pool.GetMachineType()
+	}
+	return o
+}
+
+// pipelineString returns the first of the named pipeline options set.
+func pipelineString(fields map[string]*structpb.Value, names []string) string {
+	for _, name := range names {
+		if v, ok := fields[name]; ok {
+			switch k := v.GetKind().(type) {
+			case *structpb.Value_StringValue:
+				return k.StringValue
+			case *structpb.Value_NumberValue:
+				return strconv.FormatFloat(k.NumberValue, 'f', -1, 64)
+			}
+		}
+	}
+	return ""
+}
+
+// pipelineInt returns the first of the named pipeline options set as an
+// integer, which SDKs report as a number or a string.
+func pipelineInt(fields map[string]*structpb.Value, names []string) int64 {
+	n, _ := strconv.ParseInt(pipelineString(fields, names), 10, 64)
+	return n
+}
@@ -0,0 +1,127 @@
+package workercount
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for lookups skipped by a Breaker because the
+// same job kept failing.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Breaker is a circuit breaker for lookups, keyed by job, so that a job or
+// project that keeps failing is skipped for a while rather than every request
+// waiting on a broken backend. A nil *Breaker lets every lookup through.
+type Breaker struct {
+	// failures is the number of consecutive failures opening a circuit.
+	failures int
+	// cooldown is how long an open circuit skips its key before a single
+	// lookup is let through to probe it.
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of a key of a Breaker.
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	// probing is set while the lookup probing an open circuit whose
+	// cooldown elapsed is in flight.
+	probing bool
+}
+
+// NewBreaker returns a Breaker opening the circuit of a key after failures
+// consecutive failures, for cooldown.
+func NewBreaker(failures int, cooldown time.Duration) *Breaker {
+	return &Breaker{failures: failures, cooldown: cooldown, circuits: map[string]*circuit{}}
+}
+
+// BreakerKey returns the key of the job looked up with opts.
+func BreakerKey(opts Options) string {
+	return opts.ProjectID + "/" + opts.Location + "/" + opts.Job()
+}
+
+// Allow reports whether a lookup of key may proceed. Otherwise it returns the
+// time until which the circuit of key is open. Once the cooldown elapsed, a
+// single lookup is allowed to probe whether the backend recovered.
+func (b *Breaker) Allow(key string) (bool, time.Time) {
+	if b == nil {
+		return true, time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[key]
+	if c == nil || c.openUntil.IsZero() {
+		return true, time.Time{}
+	}
+	if c.probing || time.Now().Before(c.openUntil) {
+		return false, c.openUntil
+	}
+	c.probing = true
+	return true, time.Time{}
+}
+
+// Record records the outcome of a lookup of key allowed by Allow, reporting
+// whether it opened the circuit of key. Failures describing the job rather
+// than the backend, like ErrNoEvents, and cancelled lookups do not count.
+// Every lookup allowed must be recorded, or released with Release.
+func (b *Breaker) Record(key string, err error) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[key]
+	switch {
+	case err == nil || errors.Is(err, ErrNoEvents) || errors.Is(err, ErrUnexpectedState):
+		delete(b.circuits, key)
+		return false
+	case errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled:
+		if c != nil {
+			c.probing = false
+		}
+		return false
+	}
+	if c == nil {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	c.failures++
+	if !c.probing && c.failures < b.failures {
+		return false
+	}
+	c.probing = false
+	c.openUntil = time.Now().Add(b.cooldown)
+	return true
+}
+
+// Release ends a lookup of key allowed by Allow without an outcome, e.g.
+// because it was served from a cache, so a probe of its open circuit may be
+// let through again.
+func (b *Breaker) Release(key string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[key]; c != nil {
+		c.probing = false
+	}
+}
+
+// Open reports whether the circuit of key is open, skipping its lookups.
+func (b *Breaker) Open(key string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[key]
+	return c != nil && !c.openUntil.IsZero() && (c.probing || time.Now().Before(c.openUntil))
+}
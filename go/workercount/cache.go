@@ -0,0 +1,83 @@
+package workercount
+
+import (
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"time"
+)
+
+// Cache holds the results of lookups for a while, so repeated requests for
+// the same job, like those of an autoscaler or several dashboards polling a
+// server, do not all hit the API. A nil *Cache caches nothing.
+type Cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// group merges concurrent lookups of the same key into one.
+	group singleflight.Group
+}
+
+// cacheEntry is a result held by a Cache.
+type cacheEntry struct {
+	res       *Result
+	fetchedAt time.Time
+}
+
+// NewCache returns a Cache holding results for ttl.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+// Fetch returns the result cached under key if it is younger than the TTL,
+// along with its age. Otherwise it calls fetch, caching the result if it
+// succeeds. Concurrent calls with the same key share a single call of fetch.
+func (c *Cache) Fetch(key string, fetch func() (*Result, error)) (*Result, time.Duration, error) {
+	if c == nil {
+		res, err := fetch()
+		return res, 0, err
+	}
+	if res, age, ok := c.Get(key); ok {
+		return res, age, nil
+	}
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		res, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		c.put(key, cacheEntry{res: res, fetchedAt: time.Now()})
+		return res, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return v.(*Result), 0, nil
+}
+
+// Get returns the result cached under key and its age if it is younger than
+// the TTL.
+func (c *Cache) Get(key string) (*Result, time.Duration, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || now.Sub(e.fetchedAt) >= c.ttl {
+		return nil, 0, false
+	}
+	return e.res, now.Sub(e.fetchedAt), true
+}
+
+// put caches e under key, dropping the expired entries.
+func (c *Cache) put(key string, e cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, old := range c.entries {
+		if e.fetchedAt.Sub(old.fetchedAt) >= c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = e
+}
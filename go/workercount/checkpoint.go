@@ -0,0 +1,99 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// Checkpoint is the latest autoscaling events found by an earlier lookup of
+// a job, so a later lookup only scans the messages reported since.
+type Checkpoint struct {
+	JobID string `json:"job_id"`
+	// CurrentWorkers and TargetWorkers are the worker counts of the newest
+	// events reporting them, at CurrentTime and TargetTime, or 0 if the
+	// window scanned had none.
+	CurrentWorkers     int64     `json:"current_workers,omitempty"`
+	CurrentTime        time.Time `json:"current_time"`
+	CurrentDescription string    `json:"current_description,omitempty"`
+	TargetWorkers      int64     `json:"target_workers,omitempty"`
+	TargetTime         time.Time `json:"target_time"`
+	TargetDescription  string    `json:"target_description,omitempty"`
+	// CheckedTarget reports whether target worker counts were looked for,
+	// as Options.CheckTargetWorkers, so a TargetWorkers of 0 means the window
+	// had none rather than that they are unknown.
+	CheckedTarget bool `json:"checked_target,omitempty"`
+	// ScannedFrom and ScannedUntil are the start and end of the window
+	// scanned.
+	ScannedFrom  time.Time `json:"scanned_from"`
+	ScannedUntil time.Time `json:"scanned_until"`
+}
+
+// newCheckpoint returns the checkpoint of the events found by t in the window
+// from start to end, or nil if it found none.
+func newCheckpoint(jobID string, t *latestEventTracker, start, end time.Time) *Checkpoint {
+	if t.current == nil && t.target == nil {
+		return nil
+	}
+	cp := &Checkpoint{JobID: jobID, CheckedTarget: t.checkTarget, ScannedFrom: start, ScannedUntil: end}
+	if t.current != nil {
+		cp.CurrentWorkers, cp.CurrentTime = t.current.GetCurrentNumWorkers(), t.currentTime
+		cp.CurrentDescription = t.current.GetDescription().GetMessageText()
+	}
+	if t.target != nil {
+		cp.TargetWorkers, cp.TargetTime = t.target.GetTargetNumWorkers(), t.targetTime
+		cp.TargetDescription = t.target.GetDescription().GetMessageText()
+	}
+	return cp
+}
+
+// resumeFrom returns the start of the scan of a window starting at start
+// that cp lets be skipped, or start if cp does not apply. Target worker
+// counts disregarded for cooldown by the earlier lookup are scanned again.
+func (cp *Checkpoint) resumeFrom(o Options, start time.Time, t *latestEventTracker) time.Time {
+	if cp == nil || cp.JobID != o.JobID || !o.EndTime.IsZero() || t.wholeWindow() {
+		return start
+	}
+	if t.checkTarget && !cp.CheckedTarget {
+		// The earlier lookup did not look for target workers.
+		return start
+	}
+	if start.Before(cp.ScannedFrom) && (cp.CurrentWorkers == 0 || t.checkTarget && cp.TargetWorkers == 0) {
+		// The events the earlier lookup did not find may lie before the
+		// window it scanned.
+		return start
+	}
+	resume := cp.ScannedUntil.Add(-o.Cooldown)
+	if cp.CurrentWorkers > 0 && cp.CurrentTime.Before(resume) {
+		resume = cp.CurrentTime
+	}
+	if t.checkTarget && cp.TargetWorkers > 0 && cp.TargetTime.Before(resume) {
+		resume = cp.TargetTime
+	}
+	if resume.Before(start) {
+		return start
+	}
+	return resume
+}
+
+// fill hands t the events of cp it did not find itself, as long as they lie
+// within the window starting at start.
+func (cp *Checkpoint) fill(t *latestEventTracker, start time.Time) {
+	if t.current == nil && cp.CurrentWorkers > 0 && !cp.CurrentTime.Before(start) {
+		t.current = &dataflowpb.AutoscalingEvent{
+			CurrentNumWorkers: cp.CurrentWorkers,
+			Time:              timestamppb.New(cp.CurrentTime),
+			Description:       &dataflowpb.StructuredMessage{MessageText: cp.CurrentDescription},
+		}
+		t.currentTime = cp.CurrentTime
+	}
+	if t.checkTarget && t.target == nil && cp.TargetWorkers > 0 && !cp.TargetTime.Before(start) &&
+		(t.targetBefore.IsZero() || cp.TargetTime.Before(t.targetBefore)) {
+		t.target = &dataflowpb.AutoscalingEvent{
+			TargetNumWorkers: cp.TargetWorkers,
+			Time:             timestamppb.New(cp.TargetTime),
+			Description:      &dataflowpb.StructuredMessage{MessageText: cp.TargetDescription},
+		}
+		t.targetTime = cp.TargetTime
+	}
+}
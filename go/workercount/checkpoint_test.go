@@ -0,0 +1,72 @@
+package workercount
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckpointResumeFrom(t *testing.T) {
+	at := func(minute int) time.Time { return testEventTime.Add(time.Duration(minute) * time.Minute) }
+	start := at(0)
+	// withTarget is the checkpoint of a lookup that found current and target
+	// worker counts in the window from start to minute 60.
+	withTarget := func() *Checkpoint {
+		return &Checkpoint{
+			JobID:          "job",
+			CurrentWorkers: 3,
+			CurrentTime:    at(40),
+			TargetWorkers:  5,
+			TargetTime:     at(30),
+			CheckedTarget:  true,
+			ScannedFrom:    start,
+			ScannedUntil:   at(60),
+		}
+	}
+	// withoutTarget is the checkpoint of a job that reported no target
+	// worker counts in the same window.
+	withoutTarget := func() *Checkpoint {
+		cp := withTarget()
+		cp.TargetWorkers, cp.TargetTime = 0, time.Time{}
+		return cp
+	}
+
+	for _, tc := range []struct {
+		name        string
+		cp          *Checkpoint
+		opts        Options
+		start       time.Time
+		checkTarget bool
+		keepEvents  bool
+		want        time.Time
+	}{
+		{name: "no checkpoint", start: start, checkTarget: true, want: start},
+		{name: "other job", cp: &Checkpoint{JobID: "other", CurrentWorkers: 3, CurrentTime: at(40), ScannedFrom: start, ScannedUntil: at(60)}, start: start, want: start},
+		{name: "window with end time", cp: withTarget(), opts: Options{EndTime: at(90)}, start: start, checkTarget: true, want: start},
+		{name: "whole window needed", cp: withTarget(), start: start, checkTarget: true, keepEvents: true, want: start},
+		{name: "target workers", cp: withTarget(), start: start, checkTarget: true, want: at(30)},
+		{name: "target workers not checked", cp: withTarget(), start: start, want: at(40)},
+		{name: "cooldown", cp: withTarget(), opts: Options{Cooldown: 45 * time.Minute}, start: start, checkTarget: true, want: at(15)},
+		{name: "events before window", cp: withTarget(), start: at(35), checkTarget: true, want: at(35)},
+		{name: "without target workers", cp: withoutTarget(), start: start, checkTarget: true, want: at(40)},
+		{name: "without target workers in wider window", cp: withoutTarget(), start: at(-30), checkTarget: true, want: at(-30)},
+		{name: "without target workers not checked in wider window", cp: withoutTarget(), start: at(-30), want: at(40)},
+		{name: "target workers not checked by earlier lookup", cp: func() *Checkpoint {
+			cp := withoutTarget()
+			cp.CheckedTarget = false
+			return cp
+		}(), start: start, checkTarget: true, want: start},
+		{name: "without current workers in wider window", cp: func() *Checkpoint {
+			cp := withTarget()
+			cp.CurrentWorkers, cp.CurrentTime = 0, time.Time{}
+			return cp
+		}(), start: at(-30), checkTarget: true, want: at(-30)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.JobID = "job"
+			tracker := &latestEventTracker{checkTarget: tc.checkTarget, keepEvents: tc.keepEvents}
+			if got := tc.cp.resumeFrom(tc.opts, tc.start, tracker); !got.Equal(tc.want) {
+				t.Errorf("resumeFrom() = %s, want %s", got.Format(time.RFC3339), tc.want.Format(time.RFC3339))
+			}
+		})
+	}
+}
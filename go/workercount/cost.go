@@ -0,0 +1,68 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+)
+
+// Prices are the hourly list prices used to estimate the cost of a job's
+// workers. Estimates only cover worker vCPUs and memory, not disks, Shuffle,
+// Streaming Engine, GPUs or discounts, so they are approximate.
+type Prices struct {
+	Batch     ResourcePrices `json:"batch"`
+	Streaming ResourcePrices `json:"streaming"`
+	// MachineTypes are hourly prices per worker by machine type, e.g.
+	// {"n2-standard-4": 0.25}, taking precedence over the resource prices.
+	MachineTypes map[string]float64 `json:"machine_types,omitempty"`
+}
+
+// ResourcePrices are the hourly prices of a worker vCPU and GB of memory.
+type ResourcePrices struct {
+	VCPUHour     float64 `json:"vcpu_hour"`
+	MemoryGBHour float64 `json:"memory_gb_hour"`
+}
+
+// DefaultPrices are the Dataflow worker list prices in us-central1 in USD.
+var DefaultPrices = Prices{
+	Batch:     ResourcePrices{VCPUHour: 0.056, MemoryGBHour: 0.003557},
+	Streaming: ResourcePrices{VCPUHour: 0.069, MemoryGBHour: 0.003557},
+}
+
+// WorkerHourly returns the hourly price of a worker of machineType in a job
+// of jobType, e.g. "JOB_TYPE_STREAMING".
+func (p *Prices) WorkerHourly(machineType, jobType string) (float64, error) {
+	if price, ok := p.MachineTypes[machineType]; ok {
+		return price, nil
+	}
+	m, err := ParseMachineType(machineType)
+	if err != nil {
+		return 0, err
+	}
+	r := p.Batch
+	if jobType == dataflowpb.JobType_JOB_TYPE_STREAMING.String() {
+		r = p.Streaming
+	}
+	return float64(m.VCPUs)*r.VCPUHour + m.MemoryGB*r.MemoryGBHour, nil
+}
+
+// CostEstimate is the estimated cost of a job's workers.
+type CostEstimate struct {
+	// WorkerHourly is the hourly price of one worker and Hourly that of the
+	// desired workers.
+	WorkerHourly float64 `json:"worker_hourly"`
+	Hourly       float64 `json:"hourly"`
+	// Window is the estimated cost of the window if Options.WindowCost was
+	// set.
+	Window *WindowCost `json:"window,omitempty"`
+}
+
+// WindowCost is the estimated cost of a job's workers over the window,
+// integrating its current worker counts over time.
+type WindowCost struct {
+	WorkerHours float64 `json:"worker_hours"`
+	Cost        float64 `json:"cost"`
+	// CoveredSeconds is the part of the window's WindowSeconds the worker
+	// hours cover. The worker count before the first event of the window is
+	// unknown, so that part is left out.
+	CoveredSeconds float64 `json:"covered_seconds"`
+	WindowSeconds  float64 `json:"window_seconds"`
+}
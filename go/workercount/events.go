@@ -0,0 +1,186 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"sort"
+	"time"
+)
+
+// eventPager yields the autoscaling events reported with a job's messages,
+// and the messages themselves, one page of the listing at a time.
+type eventPager interface {
+	// NextPage returns the autoscaling events and job messages of the next
+	// page, or iterator.Done after the last one.
+	NextPage() ([]*dataflowpb.AutoscalingEvent, []*dataflowpb.JobMessage, error)
+}
+
+// messagePageFunc makes a single ListJobMessages call, returning the page of
+// req.PageToken.
+type messagePageFunc func(req *dataflowpb.ListJobMessagesRequest) (*dataflowpb.ListJobMessagesResponse, error)
+
+// messagePager is the eventPager over the responses of ListJobMessages.
+//
+// Autoscaling events are only available on the raw responses, not as the
+// items of the client's iterator, whose Next also skips the responses
+// without messages, events included. The pager makes one call per page
+// itself, following the next page tokens, so every response is read exactly
+// once.
+type messagePager struct {
+	fetch messagePageFunc
+	req   *dataflowpb.ListJobMessagesRequest
+	done  bool
+}
+
+// newMessagePager returns the pager over the messages selected by req, which
+// it takes over. A req.PageSize of 0 leaves the page size to the API.
+func newMessagePager(fetch messagePageFunc, req *dataflowpb.ListJobMessagesRequest) *messagePager {
+	return &messagePager{fetch: fetch, req: req}
+}
+
+func (p *messagePager) NextPage() ([]*dataflowpb.AutoscalingEvent, []*dataflowpb.JobMessage, error) {
+	if p.done {
+		return nil, nil, iterator.Done
+	}
+	resp, err := p.fetch(p.req)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.req.PageToken = resp.GetNextPageToken()
+	p.done = p.req.PageToken == ""
+	return resp.GetAutoscalingEvents(), resp.GetJobMessages(), nil
+}
+
+// messagePage returns the messagePageFunc of c, calling the API with ctx.
+// It is the only use of the internals of the client's iterator:
+// InternalFetch makes exactly one call, unlike Next which goes on past the
+// responses without messages. TestMessagePageAgainstFake pins it to the
+// client library in use.
+func (c *Client) messagePage(ctx context.Context) messagePageFunc {
+	return func(req *dataflowpb.ListJobMessagesRequest) (*dataflowpb.ListJobMessagesResponse, error) {
+		it := c.messages.ListJobMessages(ctx, req)
+		if _, _, err := it.InternalFetch(int(req.GetPageSize()), req.GetPageToken()); err != nil {
+			return nil, err
+		}
+		resp, ok := it.Response.(*dataflowpb.ListJobMessagesResponse)
+		if !ok {
+			return nil, fmt.Errorf("unexpected job messages response of type %T", it.Response)
+		}
+		return resp, nil
+	}
+}
+
+// Event is an autoscaling event, as listed in Result.Events.
+type Event struct {
+	Time           time.Time `json:"time"`
+	Type           string    `json:"type"`
+	CurrentWorkers int64     `json:"current_workers"`
+	TargetWorkers  int64     `json:"target_workers"`
+	Description    string    `json:"description,omitempty"`
+}
+
+// newEvents converts events, ordering them oldest first.
+func newEvents(events []*dataflowpb.AutoscalingEvent) []Event {
+	list := make([]Event, len(events))
+	for i, e := range events {
+		list[i] = Event{
+			Time:           e.GetTime().AsTime(),
+			Type:           e.GetEventType().String(),
+			CurrentWorkers: e.GetCurrentNumWorkers(),
+			TargetWorkers:  e.GetTargetNumWorkers(),
+			Description:    e.GetDescription().GetMessageText(),
+		}
+	}
+	sort.SliceStable(list, func(i, k int) bool { return list[i].Time.Before(list[k].Time) })
+	return list
+}
+
+// latestEventTracker keeps the latest autoscaling events with a current and,
+// if checkTarget, a target worker count among the events observed.
+type latestEventTracker struct {
+	checkTarget bool
+	// types, if set, are the event types considered.
+	types map[dataflowpb.AutoscalingEvent_AutoscalingEventType]bool
+	// targetBefore, if set, disregards target worker counts reported at or
+	// after it.
+	targetBefore time.Time
+	// limit stops the scan after this many events when positive.
+	limit int
+	seen  int
+	// keepEvents keeps every event considered in events, for statistics
+	// over the whole window.
+	keepEvents bool
+	events     []*dataflowpb.AutoscalingEvent
+	// messages, if set, summarizes the error and warning messages observed.
+	messages *messageSummarizer
+	// vertical, if set, collects the vertical scaling events of Dataflow
+	// Prime among the messages observed.
+	vertical *verticalScalingTracker
+
+	current, target         *dataflowpb.AutoscalingEvent
+	currentTime, targetTime time.Time
+}
+
+func (t *latestEventTracker) observe(event *dataflowpb.AutoscalingEvent) {
+	t.seen++
+	if t.types != nil && !t.types[event.GetEventType()] {
+		return
+	}
+	if t.keepEvents {
+		t.events = append(t.events, event)
+	}
+	eventTime := event.GetTime().AsTime()
+	if event.GetCurrentNumWorkers() > 0 && (t.current == nil || eventTime.After(t.currentTime)) {
+		t.current, t.currentTime = event, eventTime
+	}
+	if t.checkTarget && event.GetTargetNumWorkers() > 0 && (t.targetBefore.IsZero() || eventTime.Before(t.targetBefore)) &&
+		(t.target == nil || eventTime.After(t.targetTime)) {
+		t.target, t.targetTime = event, eventTime
+	}
+}
+
+// full reports whether the limit of events was observed.
+func (t *latestEventTracker) full() bool {
+	return t.limit > 0 && t.seen >= t.limit
+}
+
+// wholeWindow reports whether t needs every event and message of the
+// window, rather than only the latest events.
+func (t *latestEventTracker) wholeWindow() bool {
+	return t.keepEvents || t.messages != nil || t.vertical != nil
+}
+
+// observeMessage passes a job message to the trackers interested in them.
+func (t *latestEventTracker) observeMessage(m *dataflowpb.JobMessage) {
+	if t.messages != nil {
+		t.messages.observe(m)
+	}
+	if t.vertical != nil {
+		t.vertical.observe(m)
+	}
+}
+
+// scanEvents observes every event of every page of p until t is full.
+func scanEvents(p eventPager, t *latestEventTracker) error {
+	for !t.full() {
+		events, messages, err := p.NextPage()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			t.observeMessage(m)
+		}
+		for _, event := range events {
+			if t.full() {
+				break
+			}
+			t.observe(event)
+		}
+	}
+	return nil
+}
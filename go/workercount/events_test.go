@@ -0,0 +1,165 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakePages serves ListJobMessages responses by page token, recording the
+// requests made.
+type fakePages struct {
+	pages    map[string]*dataflowpb.ListJobMessagesResponse
+	requests []*dataflowpb.ListJobMessagesRequest
+}
+
+func (f *fakePages) fetch(req *dataflowpb.ListJobMessagesRequest) (*dataflowpb.ListJobMessagesResponse, error) {
+	f.requests = append(f.requests, &dataflowpb.ListJobMessagesRequest{PageSize: req.GetPageSize(), PageToken: req.GetPageToken()})
+	resp, ok := f.pages[req.GetPageToken()]
+	if !ok {
+		return nil, errors.New("unknown page token " + req.GetPageToken())
+	}
+	return resp, nil
+}
+
+var testEventTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testEvent(minute int, current, target int64) *dataflowpb.AutoscalingEvent {
+	return &dataflowpb.AutoscalingEvent{
+		Time:              timestamppb.New(testEventTime.Add(time.Duration(minute) * time.Minute)),
+		CurrentNumWorkers: current,
+		TargetNumWorkers:  target,
+	}
+}
+
+func TestMessagePagerDefaultPageSize(t *testing.T) {
+	f := &fakePages{pages: map[string]*dataflowpb.ListJobMessagesResponse{
+		"": {AutoscalingEvents: []*dataflowpb.AutoscalingEvent{testEvent(0, 2, 0)}},
+	}}
+	p := newMessagePager(f.fetch, &dataflowpb.ListJobMessagesRequest{JobId: "job"})
+
+	events, _, err := p.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage() failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("NextPage() returned %d events, want 1", len(events))
+	}
+	if _, _, err := p.NextPage(); err != iterator.Done {
+		t.Errorf("NextPage() after the last page returned %v, want iterator.Done", err)
+	}
+	if len(f.requests) != 1 || f.requests[0].GetPageSize() != 0 {
+		t.Errorf("requests = %v, want a single one without a page size", f.requests)
+	}
+}
+
+func TestMessagePagerFollowsPageTokens(t *testing.T) {
+	f := &fakePages{pages: map[string]*dataflowpb.ListJobMessagesResponse{
+		"": {
+			JobMessages:   []*dataflowpb.JobMessage{{Id: "m1"}, {Id: "m2"}},
+			NextPageToken: "p2",
+		},
+		"p2": {
+			JobMessages:   []*dataflowpb.JobMessage{{Id: "m3"}, {Id: "m4"}},
+			NextPageToken: "p3",
+		},
+		"p3": {
+			JobMessages: []*dataflowpb.JobMessage{{Id: "m5"}},
+		},
+	}}
+	p := newMessagePager(f.fetch, &dataflowpb.ListJobMessagesRequest{JobId: "job", PageSize: 2})
+
+	var ids []string
+	for {
+		_, messages, err := p.NextPage()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPage() failed: %v", err)
+		}
+		for _, m := range messages {
+			ids = append(ids, m.GetId())
+		}
+	}
+	if want := []string{"m1", "m2", "m3", "m4", "m5"}; !slices.Equal(ids, want) {
+		t.Errorf("messages = %v, want %v", ids, want)
+	}
+	var tokens []string
+	for _, req := range f.requests {
+		if req.GetPageSize() != 2 {
+			t.Errorf("request for page %q has page size %d, want 2", req.GetPageToken(), req.GetPageSize())
+		}
+		tokens = append(tokens, req.GetPageToken())
+	}
+	if want := []string{"", "p2", "p3"}; !slices.Equal(tokens, want) {
+		t.Errorf("page tokens requested = %q, want %q", tokens, want)
+	}
+}
+
+func TestMessagePagerError(t *testing.T) {
+	f := &fakePages{pages: map[string]*dataflowpb.ListJobMessagesResponse{
+		"": {NextPageToken: "missing"},
+	}}
+	p := newMessagePager(f.fetch, &dataflowpb.ListJobMessagesRequest{JobId: "job"})
+	if _, _, err := p.NextPage(); err != nil {
+		t.Fatalf("NextPage() failed: %v", err)
+	}
+	if _, _, err := p.NextPage(); err == nil || err == iterator.Done {
+		t.Errorf("NextPage() for a failing page returned %v, want its error", err)
+	}
+}
+
+func TestScanEventsAcrossPages(t *testing.T) {
+	f := &fakePages{pages: map[string]*dataflowpb.ListJobMessagesResponse{
+		"": {
+			JobMessages:       []*dataflowpb.JobMessage{{Id: "m1"}},
+			AutoscalingEvents: []*dataflowpb.AutoscalingEvent{testEvent(0, 1, 0), testEvent(5, 0, 3)},
+			NextPageToken:     "p2",
+		},
+		// A page with events but without messages.
+		"p2": {
+			AutoscalingEvents: []*dataflowpb.AutoscalingEvent{testEvent(10, 3, 0), testEvent(20, 0, 5)},
+			NextPageToken:     "p3",
+		},
+		"p3": {
+			JobMessages:       []*dataflowpb.JobMessage{{Id: "m2"}},
+			AutoscalingEvents: []*dataflowpb.AutoscalingEvent{testEvent(15, 4, 0)},
+		},
+	}}
+	tracker := &latestEventTracker{checkTarget: true, keepEvents: true}
+	if err := scanEvents(newMessagePager(f.fetch, &dataflowpb.ListJobMessagesRequest{JobId: "job"}), tracker); err != nil {
+		t.Fatalf("scanEvents() failed: %v", err)
+	}
+
+	if got := len(tracker.events); got != 5 {
+		t.Errorf("scanEvents() observed %d events, want 5", got)
+	}
+	if got := tracker.current.GetCurrentNumWorkers(); got != 4 {
+		t.Errorf("current workers = %d, want 4 from the last page", got)
+	}
+	if got := tracker.target.GetTargetNumWorkers(); got != 5 {
+		t.Errorf("target workers = %d, want 5 from the page without messages", got)
+	}
+}
+
+func TestScanEventsStopsAtLimit(t *testing.T) {
+	f := &fakePages{pages: map[string]*dataflowpb.ListJobMessagesResponse{
+		"":   {AutoscalingEvents: []*dataflowpb.AutoscalingEvent{testEvent(0, 1, 0), testEvent(5, 2, 0)}, NextPageToken: "p2"},
+		"p2": {AutoscalingEvents: []*dataflowpb.AutoscalingEvent{testEvent(10, 3, 0)}},
+	}}
+	tracker := &latestEventTracker{limit: 2}
+	if err := scanEvents(newMessagePager(f.fetch, &dataflowpb.ListJobMessagesRequest{JobId: "job"}), tracker); err != nil {
+		t.Fatalf("scanEvents() failed: %v", err)
+	}
+	if len(f.requests) != 1 {
+		t.Errorf("scanEvents() requested %d pages, want 1 once the limit was reached", len(f.requests))
+	}
+	if got := tracker.current.GetCurrentNumWorkers(); got != 2 {
+		t.Errorf("current workers = %d, want 2", got)
+	}
+}
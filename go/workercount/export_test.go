@@ -0,0 +1,12 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+)
+
+// MessagePage exposes messagePage to the tests running against the fake
+// Dataflow API, which cannot be imported by the tests of the package.
+func (c *Client) MessagePage(ctx context.Context) func(req *dataflowpb.ListJobMessagesRequest) (*dataflowpb.ListJobMessagesResponse, error) {
+	return c.messagePage(ctx)
+}
@@ -0,0 +1,290 @@
+package workercount
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	httpClient     *Client
+	httpClientErr  error
+	httpClientOnce sync.Once
+)
+
+// sharedClient lazily creates the Client used by HTTPHandler so that warm
+// function instances reuse their API connections across invocations.
+func sharedClient() (*Client, error) {
+	httpClientOnce.Do(func() {
+		httpClient, httpClientErr = NewClient(context.Background())
+	})
+	return httpClient, httpClientErr
+}
+
+// HTTPHandler serves the desired worker count for the job described by the
+// request's query parameters as a JSON Result. The parameters mirror the
+// command line flags, as parsed by ParseOptions: project_id, location and
+// job_id (or job_name or template_path) are required, the others optional.
+//
+// The cloudfunction package registers it with the Functions Framework, so it
+// can be deployed as a Cloud Function (e.g. triggered by Cloud Scheduler) or
+// served on Cloud Run without a separate server wrapper. It uses application default
+// credentials; use NewHandler to serve with a specific Client.
+func HTTPHandler(w http.ResponseWriter, r *http.Request) {
+	client, err := sharedClient()
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	(&Handler{Client: client}).ServeHTTP(w, r)
+}
+
+// DefaultHandlerTimeout is the Handler.Timeout used when it is not set.
+const DefaultHandlerTimeout = 2 * time.Minute
+
+// Handler is an http.Handler behaving like HTTPHandler but using Client.
+type Handler struct {
+	Client *Client
+	// Breaker, if not nil, skips the jobs whose circuit it opened,
+	// responding 503 Service Unavailable with a Retry-After header until it
+	// closes.
+	Breaker *Breaker
+	// Cache, if not nil, serves repeated requests with the same query
+	// parameters from the results it holds, with an Age header. The
+	// lookups it shares between concurrent requests are not cancelled when
+	// a client disconnects, but bounded by Timeout instead.
+	Cache *Cache
+	// Timeout bounds the lookups shared through Cache. Zero means
+	// DefaultHandlerTimeout.
+	Timeout time.Duration
+
+	// fetch, if set, replaces Client.Fetch, for tests.
+	fetch func(ctx context.Context, opts Options) (*Result, error)
+}
+
+// NewHandler returns an http.Handler behaving like HTTPHandler but using c.
+func NewHandler(c *Client) http.Handler {
+	return &Handler{Client: c}
+}
+
+// ServeHTTP serves the result for the request's query parameters.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	opts, err := ParseOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Encode sorts the parameters, so their order does not matter.
+	cacheKey := r.URL.Query().Encode()
+	res, age, cached := h.Cache.Get(cacheKey)
+	if !cached {
+		// Cached results are served even while the circuit is open, and
+		// do not take the single lookup probing it.
+		key := BreakerKey(opts)
+		if ok, until := h.Breaker.Allow(key); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+			http.Error(w, fmt.Sprintf("job %s: %v until %s after repeated failures", opts.Job(), ErrCircuitOpen, until.UTC().Format(time.RFC3339)), http.StatusServiceUnavailable)
+			return
+		}
+		res, age, err = h.lookup(r.Context(), cacheKey, key, opts)
+	}
+	if err != nil {
+		status := http.StatusBadGateway
+		switch {
+		case errors.Is(err, ErrNoEvents):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrUnexpectedState):
+			status = http.StatusConflict
+		}
+		log.Printf("ERROR: job %s: %v", opts.Job(), err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if age > 0 {
+		w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("ERROR: writing response: %v", err)
+	}
+}
+
+// lookup fetches the result for opts through the cache, recording its
+// outcome under the breaker key allowed. A lookup shared with concurrent
+// requests for cacheKey does not run on the context of the request but is
+// bounded by h.Timeout.
+func (h *Handler) lookup(ctx context.Context, cacheKey, key string, opts Options) (*Result, time.Duration, error) {
+	if h.Cache != nil {
+		timeout := h.Timeout
+		if timeout <= 0 {
+			timeout = DefaultHandlerTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+	}
+	fetch := h.fetch
+	if fetch == nil {
+		fetch = h.Client.Fetch
+	}
+	recorded := false
+	res, age, err := h.Cache.Fetch(cacheKey, func() (*Result, error) {
+		res, err := fetch(ctx, opts)
+		recorded = true
+		if h.Breaker.Record(key, err) {
+			log.Printf("WARN: job %s: circuit opened after repeated failures, skipping its lookups", opts.Job())
+		}
+		return res, err
+	})
+	if !recorded {
+		// The result came from the cache or a lookup of another request,
+		// so the lookup allowed was not made.
+		h.Breaker.Release(key)
+	}
+	return res, age, err
+}
+
+// ParseOptions builds Options from parameters named like the command line
+// flags, using the same defaults. Timestamps such as start_time are RFC 3339.
+// Unknown parameters are ignored.
+func ParseOptions(q url.Values) (Options, error) {
+	opts := Options{
+		ProjectID:          q.Get("project_id"),
+		Location:           q.Get("location"),
+		JobID:              q.Get("job_id"),
+		JobName:            q.Get("job_name"),
+		TemplatePath:       q.Get("template_path"),
+		MinImportance:      q.Get("min_importance"),
+		Stat:               q.Get("stat"),
+		RequireState:       q.Get("require_state"),
+		Pool:               q.Get("pool"),
+		WaitForState:       q.Get("wait_for_state"),
+		CheckTargetWorkers: true,
+	}
+
+	if v := q.Get("job_url"); v != "" {
+		projectID, location, jobID, err := ParseJobURL(v)
+		if err != nil {
+			return opts, err
+		}
+		if opts.ProjectID == "" {
+			opts.ProjectID = projectID
+		}
+		if opts.Location == "" {
+			opts.Location = location
+		}
+		if opts.JobID == "" {
+			opts.JobID = jobID
+		}
+	}
+	if v := q.Get("event_types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opts.EventTypes = append(opts.EventTypes, t)
+			}
+		}
+	}
+	// Every invalid parameter is reported at once.
+	err := errors.Join(
+		parseInt(q, "time_delta_minutes", &opts.TimeDeltaMinutes),
+		parseDuration(q, "lookback", &opts.Lookback),
+		parseTime(q, "start_time", &opts.StartTime),
+		parseTime(q, "end_time", &opts.EndTime),
+		parseBool(q, "auto_expand_lookback", &opts.AutoExpandLookback),
+		parseDuration(q, "max_lookback", &opts.MaxLookback),
+		parseInt(q, "max_events", &opts.MaxEvents),
+		parseInt32(q, "page_size", &opts.PageSize),
+		parseDuration(q, "wait_timeout", &opts.WaitTimeout),
+		parseDuration(q, "cooldown", &opts.Cooldown),
+		parseDuration(q, "max_event_age", &opts.MaxEventAge),
+		parseInt64(q, "stable_tolerance", &opts.StableTolerance),
+		parseFloat(q, "max_hourly_cost", &opts.MaxHourlyCost),
+		parseInt64(q, "min_worker", &opts.MinWorker),
+		parseInt64(q, "max_worker", &opts.MaxWorker),
+		parseBool(q, "fetch_job_status", &opts.FetchJobStatus),
+		parseBool(q, "wait_stable", &opts.WaitStable),
+		parseBool(q, "summarize_messages", &opts.SummarizeMessages),
+		parseBool(q, "with_metrics", &opts.WithMetrics),
+		parseBool(q, "watermark_age", &opts.WatermarkAge),
+		parseBool(q, "worker_cpu", &opts.WorkerCPU),
+		parseBool(q, "pools", &opts.Pools),
+		parseBool(q, "resources", &opts.Resources),
+		parseBool(q, "job_details", &opts.JobDetails),
+		parseBool(q, "vertical_scaling", &opts.VerticalScaling),
+		parseBool(q, "estimate_cost", &opts.EstimateCost),
+		parseBool(q, "window_cost", &opts.WindowCost),
+		parseBool(q, "check_quota", &opts.CheckQuota),
+		parseBool(q, "verify_instances", &opts.VerifyInstances),
+		parseBool(q, "zero_if_terminal", &opts.ZeroIfTerminal),
+		parseBool(q, "check_target_workers", &opts.CheckTargetWorkers),
+		parseBool(q, "ignore_downscale", &opts.IgnoreDownscale),
+		parseBool(q, "monitoring_fallback", &opts.MonitoringFallback),
+		parseBool(q, "job_config_fallback", &opts.JobConfigFallback),
+		parseBool(q, "trend", &opts.Trend),
+		parseBool(q, "rate", &opts.Rate),
+		parseBool(q, "histogram", &opts.Histogram),
+		parseBool(q, "include_events", &opts.IncludeEvents),
+	)
+	return opts, err
+}
+
+// parseParam sets *dst to the query parameter name parsed with parse, unless
+// the parameter is empty.
+func parseParam[T any](q url.Values, name string, dst *T, parse func(string) (T, error)) error {
+	v := q.Get(name)
+	if v == "" {
+		return nil
+	}
+	x, err := parse(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %v", name, v, err)
+	}
+	*dst = x
+	return nil
+}
+
+func parseInt(q url.Values, name string, dst *int) error {
+	return parseParam(q, name, dst, strconv.Atoi)
+}
+
+func parseInt32(q url.Values, name string, dst *int32) error {
+	return parseParam(q, name, dst, func(v string) (int32, error) {
+		n, err := strconv.ParseInt(v, 10, 32)
+		return int32(n), err
+	})
+}
+
+func parseInt64(q url.Values, name string, dst *int64) error {
+	return parseParam(q, name, dst, func(v string) (int64, error) { return strconv.ParseInt(v, 10, 64) })
+}
+
+func parseFloat(q url.Values, name string, dst *float64) error {
+	return parseParam(q, name, dst, func(v string) (float64, error) { return strconv.ParseFloat(v, 64) })
+}
+
+func parseBool(q url.Values, name string, dst *bool) error {
+	return parseParam(q, name, dst, strconv.ParseBool)
+}
+
+func parseDuration(q url.Values, name string, dst *time.Duration) error {
+	return parseParam(q, name, dst, time.ParseDuration)
+}
+
+func parseTime(q url.Values, name string, dst *time.Time) error {
+	return parseParam(q, name, dst, func(v string) (time.Time, error) { return time.Parse(time.RFC3339, v) })
+}
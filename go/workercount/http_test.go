@@ -0,0 +1,98 @@
+package workercount
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeBackend serves lookups for a Handler, failing while err is set.
+type fakeBackend struct {
+	calls int
+	err   error
+}
+
+func (f *fakeBackend) fetch(ctx context.Context, opts Options) (*Result, error) {
+	f.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Result{ProjectID: opts.ProjectID, Location: opts.Location, JobID: opts.JobID, CurrentWorkers: 3}, nil
+}
+
+// serve serves a request for the test job with the extra query parameters
+// on ctx, returning the response status.
+func serve(ctx context.Context, h http.Handler, extra string) int {
+	r := httptest.NewRequest(http.MethodGet, "/?project_id=project&location=region&job_id=job"+extra, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.WithContext(ctx))
+	return w.Code
+}
+
+func TestHandlerProbeServedFromCache(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	b := &fakeBackend{}
+	h := &Handler{Breaker: NewBreaker(1, cooldown), Cache: NewCache(time.Hour), fetch: b.fetch}
+	ctx := context.Background()
+
+	if code := serve(ctx, h, "&lookback=1h"); code != http.StatusOK {
+		t.Fatalf("first lookup returned %d, want %d", code, http.StatusOK)
+	}
+	b.err = errors.New("backend down")
+	if code := serve(ctx, h, "&lookback=2h"); code != http.StatusBadGateway {
+		t.Fatalf("failing lookup returned %d, want %d", code, http.StatusBadGateway)
+	}
+	if code := serve(ctx, h, "&lookback=2h"); code != http.StatusServiceUnavailable {
+		t.Fatalf("lookup with the circuit open returned %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	time.Sleep(cooldown)
+	b.err = nil
+	if code := serve(ctx, h, "&lookback=1h"); code != http.StatusOK {
+		t.Fatalf("cached lookup after the cooldown returned %d, want %d", code, http.StatusOK)
+	}
+	calls := b.calls
+	if code := serve(ctx, h, "&lookback=2h"); code != http.StatusOK {
+		t.Errorf("lookup missing the cache after the cooldown returned %d, want %d", code, http.StatusOK)
+	}
+	if b.calls != calls+1 {
+		t.Errorf("lookup missing the cache after the cooldown made %d backend calls, want 1", b.calls-calls)
+	}
+}
+
+func TestHandlerSharedLookupOutlivesRequest(t *testing.T) {
+	b := &fakeBackend{}
+	h := &Handler{Breaker: NewBreaker(1, time.Hour), Cache: NewCache(time.Hour), fetch: b.fetch}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The lookup may be shared with other requests, so the disconnect of
+	// the one making it does not cancel it.
+	if code := serve(ctx, h, ""); code != http.StatusOK {
+		t.Errorf("lookup of a cancelled request returned %d, want %d", code, http.StatusOK)
+	}
+	if code := serve(context.Background(), h, ""); code != http.StatusOK || b.calls != 1 {
+		t.Errorf("second lookup returned %d after %d backend calls, want %d from the cache", code, b.calls, http.StatusOK)
+	}
+}
+
+func TestHandlerCancelledLookupNotAFailure(t *testing.T) {
+	b := &fakeBackend{}
+	h := &Handler{Breaker: NewBreaker(1, time.Hour), fetch: b.fetch}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	serve(ctx, h, "")
+	if h.Breaker.Open(BreakerKey(Options{ProjectID: "project", Location: "region", JobID: "job"})) {
+		t.Error("a cancelled lookup opened the circuit")
+	}
+	if code := serve(context.Background(), h, ""); code != http.StatusOK {
+		t.Errorf("lookup after a cancelled one returned %d, want %d", code, http.StatusOK)
+	}
+}
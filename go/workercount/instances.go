@@ -0,0 +1,78 @@
+package workercount
+
+import (
+	compute "cloud.google.com/go/compute/apiv1"
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+	"context"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/proto"
+	"strings"
+)
+
+// jobIDLabel is the label Dataflow puts on the worker instances of a job,
+// which its managed instance groups create.
+const jobIDLabel = "dataflow_job_id"
+
+// Instances are the Compute Engine instances running a job's workers.
+type Instances struct {
+	// Running are the instances in the RUNNING state and Total all of them,
+	// including those still starting or already stopping.
+	Running int64 `json:"running"`
+	Total   int64 `json:"total"`
+	// Zones are the running instances by zone, e.g. "us-central1-a", which
+	// the event counts do not show.
+	Zones map[string]int64 `json:"zones,omitempty"`
+	// Diverged reports whether Running differs from the current workers
+	// reported by the autoscaling events, hinting at zombie or missing
+	// workers.
+	Diverged bool `json:"diverged"`
+}
+
+// instancesClient returns the Compute Engine Instances client, created on
+// first use as only Options.VerifyInstances needs it.
+func (c *Client) instancesClient(ctx context.Context) (*compute.InstancesClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.instances == nil {
+		instances, err := compute.NewInstancesRESTClient(ctx, c.opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Compute Engine Instances client: %w", err)
+		}
+		c.instances = instances
+	}
+	return c.instances, nil
+}
+
+// WorkerInstances counts the Compute Engine instances of the job's workers
+// in every zone of the project, and the running ones by zone.
+func (c *Client) WorkerInstances(ctx context.Context, projectID, jobID string) (*Instances, error) {
+	client, err := c.instancesClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	it := client.AggregatedList(ctx, &computepb.AggregatedListInstancesRequest{
+		Project: projectID,
+		Filter:  proto.String(fmt.Sprintf("labels.%s = %q", jobIDLabel, jobID)),
+	})
+	n := &Instances{Zones: map[string]int64{}}
+	for {
+		pair, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("API Error listing worker instances: %w", err)
+		}
+		// Keys name the scope, e.g. "zones/us-central1-a".
+		zone := strings.TrimPrefix(pair.Key, "zones/")
+		for _, instance := range pair.Value.GetInstances() {
+			n.Total++
+			if instance.GetStatus() == computepb.Instance_RUNNING.String() {
+				n.Running++
+				n.Zones[zone]++
+			}
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,305 @@
+package workercount
+
+import (
+	dataflow "cloud.google.com/go/dataflow/apiv1beta3"
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Job filters accepted by Client.ListJobs.
+const (
+	JobFilterActive     = "active"
+	JobFilterTerminated = "terminated"
+	JobFilterAll        = "all"
+)
+
+var jobFilters = map[string]dataflowpb.ListJobsRequest_Filter{
+	JobFilterActive:     dataflowpb.ListJobsRequest_ACTIVE,
+	JobFilterTerminated: dataflowpb.ListJobsRequest_TERMINATED,
+	JobFilterAll:        dataflowpb.ListJobsRequest_ALL,
+}
+
+// ErrJobNotFound is returned by Client.FindJobByName when no active job has
+// the requested name.
+var ErrJobNotFound = errors.New("no active job found")
+
+// JobSummary describes a Dataflow job as returned by Client.ListJobs.
+type JobSummary struct {
+	ProjectID  string            `json:"project_id"`
+	Location   string            `json:"location"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	State      string            `json:"state"`
+	CreateTime time.Time         `json:"create_time"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+func newJobSummary(job *dataflowpb.Job) JobSummary {
+	return JobSummary{
+		ProjectID:  job.GetProjectId(),
+		Location:   job.GetLocation(),
+		ID:         job.GetId(),
+		Name:       job.GetName(),
+		Type:       dataflowpb.JobType_name[int32(job.GetType())],
+		State:      dataflowpb.JobState_name[int32(job.GetCurrentState())],
+		CreateTime: job.GetCreateTime().AsTime(),
+		Labels:     job.GetLabels(),
+	}
+}
+
+// ListJobs lists the jobs in a project and location matching filter, one of
+// JobFilterActive, JobFilterTerminated or JobFilterAll. An empty location
+// lists the jobs in every location using the aggregated listing.
+func (c *Client) ListJobs(ctx context.Context, projectID, location, filter string) ([]JobSummary, error) {
+	f, ok := jobFilters[filter]
+	if !ok {
+		return nil, fmt.Errorf("unknown job filter %q", filter)
+	}
+	req := &dataflowpb.ListJobsRequest{
+		ProjectId: projectID,
+		Location:  location,
+		Filter:    f,
+	}
+
+	var jobs []JobSummary
+	var it *dataflow.JobIterator
+	if location == "" {
+		it = c.jobs.AggregatedListJobs(ctx, req)
+	} else {
+		it = c.jobs.ListJobs(ctx, req)
+	}
+	for {
+		job, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("API Error listing jobs: %w", err)
+		}
+		jobs = append(jobs, newJobSummary(job))
+	}
+	return jobs, nil
+}
+
+// FindJobByName returns the most recently created active job named name.
+func (c *Client) FindJobByName(ctx context.Context, projectID, location, name string) (JobSummary, error) {
+	jobs, err := c.ListJobs(ctx, projectID, location, JobFilterActive)
+	if err != nil {
+		return JobSummary{}, err
+	}
+	var found *JobSummary
+	for i, j := range jobs {
+		if j.Name == name && (found == nil || j.CreateTime.After(found.CreateTime)) {
+			found = &jobs[i]
+		}
+	}
+	if found == nil {
+		return JobSummary{}, fmt.Errorf("%w named %q in project %s at location %s", ErrJobNotFound, name, projectID, location)
+	}
+	return *found, nil
+}
+
+// FindLatestJobFromTemplate returns the most recently created active job
+// launched from the classic template or flex template spec file at
+// templatePath, e.g. "gs://bucket/templates/ingest.json". Jobs are matched by
+// a pipeline option referencing templatePath, which requires fetching each
+// active job's full view, newest first.
+func (c *Client) FindLatestJobFromTemplate(ctx context.Context, projectID, location, templatePath string) (JobSummary, error) {
+	jobs, err := c.ListJobs(ctx, projectID, location, JobFilterActive)
+	if err != nil {
+		return JobSummary{}, err
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreateTime.After(jobs[k].CreateTime) })
+
+	for _, j := range jobs {
+		job, err := c.fullJob(ctx, projectID, location, j.ID)
+		if err != nil {
+			return JobSummary{}, err
+		}
+		if referencesValue(structpb.NewStructValue(job.GetEnvironment().GetSdkPipelineOptions()), templatePath) {
+			return j, nil
+		}
+	}
+	return JobSummary{}, fmt.Errorf("%w launched from template %s in project %s at location %s", ErrJobNotFound, templatePath, projectID, location)
+}
+
+// ParseJobURL extracts the job from a Dataflow console URL, as pasted from
+// the UI, e.g.
+// "https://console.cloud.google.com/dataflow/jobs/us-central1/2024-05-01_01_02_03-123?project=my-project"
+// or ".../dataflow/jobsDetail/locations/us-central1/jobs/2024-05-01_01_02_03-123".
+// The project is empty if the URL has no project parameter.
+func ParseJobURL(rawURL string) (projectID, location, jobID string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid job URL: %w", err)
+	}
+	// Path segments may carry matrix parameters, e.g. ";step=" or
+	// ";graphView=0".
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+		part, _, _ = strings.Cut(part, ";")
+		parts = append(parts, part)
+	}
+	for i, part := range parts {
+		switch {
+		case part == "jobs" && i > 0 && parts[i-1] == "dataflow" && i+2 < len(parts):
+			location, jobID = parts[i+1], parts[i+2]
+		case part == "jobsDetail" && i+4 < len(parts) && parts[i+1] == "locations" && parts[i+3] == "jobs":
+			location, jobID = parts[i+2], parts[i+4]
+		}
+	}
+	if location == "" || jobID == "" {
+		return "", "", "", fmt.Errorf("invalid job URL %q: expected e.g. https://console.cloud.google.com/dataflow/jobs/LOCATION/JOB_ID?project=PROJECT", rawURL)
+	}
+	return u.Query().Get("project"), location, jobID, nil
+}
+
+// fullJob fetches the job with its environment and pipeline options.
+func (c *Client) fullJob(ctx context.Context, projectID, location, jobID string) (*dataflowpb.Job, error) {
+	job, err := c.jobs.GetJob(ctx, &dataflowpb.GetJobRequest{
+		ProjectId: projectID,
+		Location:  location,
+		JobId:     jobID,
+		View:      dataflowpb.JobView_JOB_VIEW_ALL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("API Error fetching job details: %w", err)
+	}
+	return job, nil
+}
+
+// jobDetails fetches the full view of a job at most once per lookup, as
+// several options need it.
+type jobDetails struct {
+	c                          *Client
+	projectID, location, jobID string
+	job                        *dataflowpb.Job
+}
+
+func (d *jobDetails) get(ctx context.Context) (*dataflowpb.Job, error) {
+	if d.job == nil {
+		job, err := d.c.fullJob(ctx, d.projectID, d.location, d.jobID)
+		if err != nil {
+			return nil, err
+		}
+		d.job = job
+	}
+	return d.job, nil
+}
+
+// FlexRSGoal returns the flexible resource scheduling goal of a FlexRS job,
+// e.g. "FLEXRS_COST_OPTIMIZED", or "" for other jobs.
+func (c *Client) FlexRSGoal(ctx context.Context, projectID, location, jobID string) (string, error) {
+	job, err := c.fullJob(ctx, projectID, location, jobID)
+	if err != nil {
+		return "", err
+	}
+	return flexRSGoal(job), nil
+}
+
+func flexRSGoal(job *dataflowpb.Job) string {
+	goal := job.GetEnvironment().GetFlexResourceSchedulingGoal()
+	if goal == dataflowpb.FlexResourceSchedulingGoal_FLEXRS_UNSPECIFIED {
+		return ""
+	}
+	return goal.String()
+}
+
+// JobMetadata answers the usual triage questions about a job: when it was
+// created and started, and with which SDK and runner.
+type JobMetadata struct {
+	CreateTime time.Time `json:"create_time"`
+	// StartTime is when the job was started, which may be well after
+	// CreateTime for FlexRS jobs. It is zero until then.
+	StartTime time.Time `json:"start_time"`
+	// SDK is the Apache Beam SDK, e.g. "Apache Beam SDK for Java", written
+	// in SDKLanguage, e.g. "Java", with its SDKVersion and
+	// SDKSupportStatus, e.g. "STALE".
+	SDK              string `json:"sdk,omitempty"`
+	SDKLanguage      string `json:"sdk_language,omitempty"`
+	SDKVersion       string `json:"sdk_version,omitempty"`
+	SDKSupportStatus string `json:"sdk_support_status,omitempty"`
+	// RunnerVersion is "v2" for jobs on Dataflow Runner v2, else "v1".
+	RunnerVersion string `json:"runner_version"`
+}
+
+// runnerV2Experiments are the experiments enabling Dataflow Runner v2.
+var runnerV2Experiments = []string{"use_runner_v2", "use_unified_worker"}
+
+func newJobMetadata(job *dataflowpb.Job) *JobMetadata {
+	sdk := job.GetJobMetadata().GetSdkVersion()
+	m := &JobMetadata{
+		CreateTime:    job.GetCreateTime().AsTime(),
+		SDK:           sdk.GetVersionDisplayName(),
+		SDKVersion:    sdk.GetVersion(),
+		RunnerVersion: "v1",
+	}
+	if job.GetStartTime() != nil {
+		m.StartTime = job.GetStartTime().AsTime()
+	}
+	if sdk != nil {
+		m.SDKSupportStatus = sdk.GetSdkSupportStatus().String()
+	}
+	// Display names read e.g. "Apache Beam SDK for Java" or
+	// "Apache Beam Python 3.11 SDK".
+	for _, language := range []string{"Java", "Python", "Go"} {
+		if strings.Contains(m.SDK, " "+language+" ") || strings.HasSuffix(m.SDK, " "+language) {
+			m.SDKLanguage = language
+			break
+		}
+	}
+	for _, experiment := range runnerV2Experiments {
+		if hasServiceOption(job, experiment) {
+			m.RunnerVersion = "v2"
+		}
+	}
+	return m
+}
+
+// ConfiguredWorkers returns the number of workers the job's worker pools of
+// kind, or all of them if empty, are configured with, e.g. by --num_workers
+// at launch.
+func (c *Client) ConfiguredWorkers(ctx context.Context, projectID, location, jobID, kind string) (int64, error) {
+	pools, err := c.WorkerPools(ctx, projectID, location, jobID, kind)
+	if err != nil {
+		return 0, err
+	}
+	var workers int64
+	for _, pool := range pools {
+		workers += pool.NumWorkers
+	}
+	if workers == 0 {
+		return 0, errors.New("the job's environment configures no workers")
+	}
+	return workers, nil
+}
+
+// referencesValue reports whether v or any value nested in it is the string s.
+func referencesValue(v *structpb.Value, s string) bool {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return k.StringValue == s
+	case *structpb.Value_StructValue:
+		for _, f := range k.StructValue.GetFields() {
+			if referencesValue(f, s) {
+				return true
+			}
+		}
+	case *structpb.Value_ListValue:
+		for _, e := range k.ListValue.GetValues() {
+			if referencesValue(e, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package workercount
+
+import "testing"
+
+func TestParseJobURL(t *testing.T) {
+	const jobID = "2024-05-01_01_02_03-123"
+	for _, tc := range []struct {
+		name                               string
+		url                                string
+		wantProject, wantLocation, wantJob string
+		wantErr                            bool
+	}{
+		{
+			name:         "jobs with project",
+			url:          "https://console.cloud.google.com/dataflow/jobs/us-central1/" + jobID + "?project=my-project",
+			wantProject:  "my-project",
+			wantLocation: "us-central1",
+			wantJob:      jobID,
+		},
+		{
+			name:         "jobs without project",
+			url:          "https://console.cloud.google.com/dataflow/jobs/us-central1/" + jobID,
+			wantLocation: "us-central1",
+			wantJob:      jobID,
+		},
+		{
+			name:         "jobs with trailing segments",
+			url:          "https://console.cloud.google.com/dataflow/jobs/europe-west1/" + jobID + "/metrics?project=my-project&authuser=1",
+			wantProject:  "my-project",
+			wantLocation: "europe-west1",
+			wantJob:      jobID,
+		},
+		{
+			name:         "jobsDetail with project",
+			url:          "https://console.cloud.google.com/dataflow/jobsDetail/locations/us-east1/jobs/" + jobID + "?project=my-project",
+			wantProject:  "my-project",
+			wantLocation: "us-east1",
+			wantJob:      jobID,
+		},
+		{
+			name:         "jobsDetail with matrix parameters",
+			url:          "https://console.cloud.google.com/dataflow/jobsDetail/locations/us-east1/jobs/" + jobID + ";step=;mainTab=JOB_GRAPH?project=my-project",
+			wantProject:  "my-project",
+			wantLocation: "us-east1",
+			wantJob:      jobID,
+		},
+		{
+			name:         "jobsDetail without project",
+			url:          "https://console.cloud.google.com/dataflow/jobsDetail/locations/us-east1/jobs/" + jobID,
+			wantLocation: "us-east1",
+			wantJob:      jobID,
+		},
+		{name: "job list", url: "https://console.cloud.google.com/dataflow/jobs?project=my-project", wantErr: true},
+		{name: "missing job", url: "https://console.cloud.google.com/dataflow/jobs/us-central1?project=my-project", wantErr: true},
+		{name: "jobsDetail missing job", url: "https://console.cloud.google.com/dataflow/jobsDetail/locations/us-east1/jobs?project=my-project", wantErr: true},
+		{name: "other page", url: "https://console.cloud.google.com/compute/instances?project=my-project", wantErr: true},
+		{name: "unparsable", url: "https://console.cloud.google.com/dataflow/jobs/%zz/" + jobID, wantErr: true},
+		{name: "empty", url: "", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			project, location, job, err := ParseJobURL(tc.url)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("ParseJobURL(%q) = %q, %q, %q, want an error", tc.url, project, location, job)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJobURL(%q) failed: %v", tc.url, err)
+			}
+			if project != tc.wantProject || location != tc.wantLocation || job != tc.wantJob {
+				t.Errorf("ParseJobURL(%q) = %q, %q, %q, want %q, %q, %q", tc.url, project, location, job, tc.wantProject, tc.wantLocation, tc.wantJob)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MachineType describes the resources of a Compute Engine machine type.
+type MachineType struct {
+	Name     string  `json:"name"`
+	VCPUs    int64   `json:"vcpus"`
+	MemoryGB float64 `json:"memory_gb"`
+}
+
+// sharedCoreMachineTypes are the machine types whose resources do not follow
+// from their name.
+var sharedCoreMachineTypes = map[string]MachineType{
+	"e2-micro":  {Name: "e2-micro", VCPUs: 2, MemoryGB: 1},
+	"e2-small":  {Name: "e2-small", VCPUs: 2, MemoryGB: 2},
+	"e2-medium": {Name: "e2-medium", VCPUs: 2, MemoryGB: 4},
+	"f1-micro":  {Name: "f1-micro", VCPUs: 1, MemoryGB: 0.6},
+	"g1-small":  {Name: "g1-small", VCPUs: 1, MemoryGB: 1.7},
+}
+
+// memoryPerVCPU is the memory in GB per vCPU of the predefined machine
+// types, by series and shape.
+var memoryPerVCPU = map[string]map[string]float64{
+	"n1":  {"standard": 3.75, "highmem": 6.5, "highcpu": 0.9},
+	"n2":  {"standard": 4, "highmem": 8, "highcpu": 1},
+	"n2d": {"standard": 4, "highmem": 8, "highcpu": 1},
+	"n4":  {"standard": 4, "highmem": 8, "highcpu": 2},
+	"e2":  {"standard": 4, "highmem": 8, "highcpu": 1},
+	"c2":  {"standard": 4},
+	"c2d": {"standard": 4, "highmem": 8, "highcpu": 2},
+	"c3":  {"standard": 4, "highmem": 8, "highcpu": 2},
+	"c3d": {"standard": 4, "highmem": 8, "highcpu": 2},
+	"c4":  {"standard": 3.75, "highmem": 7.75, "highcpu": 2},
+	"t2d": {"standard": 4},
+	"t2a": {"standard": 4},
+	"g2":  {"standard": 4},
+	"m1":  {"megamem": 14.9, "ultramem": 24.025},
+}
+
+// ParseMachineType resolves the resources of a machine type from its name,
+// e.g. "n2-standard-4" (4 vCPUs, 16 GB) or a custom type like
+// "n2-custom-8-32768" or "custom-4-15360" (memory in MB).
+func ParseMachineType(name string) (MachineType, error) {
+	if m, ok := sharedCoreMachineTypes[name]; ok {
+		return m, nil
+	}
+	parts := strings.Split(strings.TrimSuffix(name, "-ext"), "-")
+	n := len(parts)
+	if n >= 3 && parts[n-3] == "custom" {
+		vcpus, err1 := strconv.ParseInt(parts[n-2], 10, 64)
+		memoryMB, err2 := strconv.ParseInt(parts[n-1], 10, 64)
+		if err1 == nil && err2 == nil && vcpus > 0 {
+			return MachineType{Name: name, VCPUs: vcpus, MemoryGB: float64(memoryMB) / 1024}, nil
+		}
+	}
+	if n == 3 {
+		vcpus, err := strconv.ParseInt(parts[2], 10, 64)
+		if perVCPU, ok := memoryPerVCPU[parts[0]][parts[1]]; ok && err == nil && vcpus > 0 {
+			return MachineType{Name: name, VCPUs: vcpus, MemoryGB: perVCPU * float64(vcpus)}, nil
+		}
+	}
+	return MachineType{}, fmt.Errorf("unknown machine type %q", name)
+}
+
+// Resources are the resources implied by the desired workers of a job.
+type Resources struct {
+	MachineType   MachineType `json:"machine_type"`
+	TotalVCPUs    int64       `json:"total_vcpus"`
+	TotalMemoryGB float64     `json:"total_memory_gb"`
+}
+
+// workerMachineType returns the machine type of the job's workers: that of
+// its pool of kind if given, else of its "harness" pool, else of its first
+// pool. It is empty if the environment does not name one.
+func workerMachineType(job *dataflowpb.Job, kind string) string {
+	return workerPool(job, kind).GetMachineType()
+}
+
+// GPUs are the accelerators attached to a job's workers.
+type GPUs struct {
+	// Type is e.g. "nvidia-tesla-t4" or "nvidia-l4".
+	Type      string `json:"type"`
+	PerWorker int64  `json:"per_worker"`
+	// Total is the number of GPUs of the desired workers.
+	Total int64 `json:"total"`
+}
+
+// l4PerG2Machine is the number of L4 GPUs of the g2-standard machine types
+// with more than one.
+var l4PerG2Machine = map[string]int64{"24": 2, "48": 4, "96": 8}
+
+// workerGPUs returns the GPU type and count per worker of job, whose workers
+// run machineType, or a zero count without GPUs. The worker_accelerator
+// service option or experiment, e.g.
+// "worker_accelerator=type:nvidia-tesla-t4;count:1;install-nvidia-driver",
+// takes precedence over the GPUs of accelerator-optimized machine types.
+func workerGPUs(job *dataflowpb.Job, machineType string) (string, int64) {
+	env := job.GetEnvironment()
+	var specs []string
+	for _, opts := range [][]string{env.GetServiceOptions(), env.GetExperiments()} {
+		for _, opt := range opts {
+			if spec, ok := strings.CutPrefix(opt, "worker_accelerator="); ok {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	for _, spec := range specs {
+		gpuType, count := "", int64(1)
+		for _, field := range strings.Split(spec, ";") {
+			k, v, _ := strings.Cut(field, ":")
+			switch k {
+			case "type":
+				gpuType = v
+			case "count":
+				if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+					count = n
+				}
+			}
+		}
+		if gpuType != "" {
+			return gpuType, count
+		}
+	}
+
+	parts := strings.Split(machineType, "-")
+	if len(parts) != 3 {
+		return "", 0
+	}
+	switch parts[0] + "-" + parts[1] {
+	case "g2-standard":
+		if n, ok := l4PerG2Machine[parts[2]]; ok {
+			return "nvidia-l4", n
+		}
+		return "nvidia-l4", 1
+	case "a2-highgpu", "a2-megagpu":
+		return "nvidia-tesla-a100", gpuCount(parts[2])
+	case "a2-ultragpu":
+		return "nvidia-a100-80gb", gpuCount(parts[2])
+	case "a3-highgpu":
+		return "nvidia-h100-80gb", gpuCount(parts[2])
+	}
+	return "", 0
+}
+
+// gpuCount parses the GPU count suffix of accelerator-optimized machine
+// types, e.g. "8g".
+func gpuCount(suffix string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSuffix(suffix, "g"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package workercount_test
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"dataflow_worker_count/fakedataflow"
+	"dataflow_worker_count/workercount"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"testing"
+	"time"
+)
+
+// TestMessagePageAgainstFake pins the single call per page that messagePage
+// makes through the iterator of the real Messages client, so that a change of
+// the client library breaking it fails here rather than in production.
+func TestMessagePageAgainstFake(t *testing.T) {
+	addr, stop, err := fakedataflow.NewServer(fakedataflow.DemoJobs(time.Now().UTC())...).Start("localhost:0")
+	if err != nil {
+		t.Fatalf("starting the fake Dataflow API failed: %v", err)
+	}
+	defer stop()
+	ctx := context.Background()
+	client, err := workercount.NewClientWithEndpoint(ctx, addr,
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	if err != nil {
+		t.Fatalf("NewClientWithEndpoint() failed: %v", err)
+	}
+	defer client.Close()
+	page := client.MessagePage(ctx)
+	newRequest := func(pageSize int32) *dataflowpb.ListJobMessagesRequest {
+		return &dataflowpb.ListJobMessagesRequest{
+			ProjectId: fakedataflow.DemoProjectID,
+			Location:  fakedataflow.DemoLocation,
+			JobId:     fakedataflow.DemoJobID,
+			PageSize:  pageSize,
+		}
+	}
+
+	all, err := page(newRequest(1000))
+	if err != nil {
+		t.Fatalf("listing every item in one page failed: %v", err)
+	}
+	if all.GetNextPageToken() != "" {
+		t.Fatalf("listing every item in one page returned the next page token %q", all.GetNextPageToken())
+	}
+	want := len(all.GetJobMessages()) + len(all.GetAutoscalingEvents())
+
+	req := newRequest(1)
+	var got, eventsOnly int
+	for pages := 1; ; pages++ {
+		if pages > want {
+			t.Fatalf("listing pages of one item did not end after %d pages", want)
+		}
+		resp, err := page(req)
+		if err != nil {
+			t.Fatalf("listing the page %q failed: %v", req.GetPageToken(), err)
+		}
+		n := len(resp.GetJobMessages()) + len(resp.GetAutoscalingEvents())
+		if n != 1 {
+			t.Errorf("page %q holds %d items, want 1 from a single call", req.GetPageToken(), n)
+		}
+		if len(resp.GetJobMessages()) == 0 && len(resp.GetAutoscalingEvents()) > 0 {
+			eventsOnly++
+		}
+		got += n
+		if req.PageToken = resp.GetNextPageToken(); req.PageToken == "" {
+			break
+		}
+	}
+	if got != want {
+		t.Errorf("pages of one item hold %d items, want %d", got, want)
+	}
+	if eventsOnly == 0 {
+		t.Error("no page held only events, want the pages without messages returned")
+	}
+}
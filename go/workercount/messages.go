@@ -0,0 +1,143 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is a job message, as listed by Client.ListMessages.
+type Message struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Importance is e.g. "JOB_MESSAGE_WARNING".
+	Importance string `json:"importance"`
+	Text       string `json:"text"`
+}
+
+// ListMessages returns the job messages of at least o.MinImportance and the
+// autoscaling events reported between start and end, both oldest first. A
+// zero end leaves the window open. o.JobID must be set, e.g. by ResolveJob.
+func (c *Client) ListMessages(ctx context.Context, o Options, start, end time.Time) ([]Message, []Event, error) {
+	importance, err := ParseImportance(o.MinImportance)
+	if err != nil {
+		return nil, nil, err
+	}
+	req := &dataflowpb.ListJobMessagesRequest{
+		ProjectId:         o.ProjectID,
+		Location:          o.Location,
+		JobId:             o.JobID,
+		MinimumImportance: importance,
+		PageSize:          o.PageSize,
+		StartTime:         timestamppb.New(start),
+	}
+	if !end.IsZero() {
+		req.EndTime = timestamppb.New(end)
+	}
+
+	var messages []Message
+	var events []*dataflowpb.AutoscalingEvent
+	p := newMessagePager(c.messagePage(ctx), req)
+	for {
+		pageEvents, pageMessages, err := p.NextPage()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("API Error fetching job messages: %w", err)
+		}
+		events = append(events, pageEvents...)
+		for _, m := range pageMessages {
+			messages = append(messages, Message{
+				ID:         m.GetId(),
+				Time:       m.GetTime().AsTime(),
+				Importance: m.GetMessageImportance().String(),
+				Text:       m.GetMessageText(),
+			})
+		}
+	}
+	sort.SliceStable(messages, func(i, k int) bool { return messages[i].Time.Before(messages[k].Time) })
+	return messages, newEvents(events), nil
+}
+
+// maxTopMessages is the number of most frequent messages listed in a
+// MessageSummary.
+const maxTopMessages = 5
+
+// MessageSummary counts the error and warning messages of the event window,
+// as reported in Result.Messages.
+type MessageSummary struct {
+	Errors   int `json:"errors"`
+	Warnings int `json:"warnings"`
+	// Top are the most frequent error and warning messages, most frequent
+	// first, errors before warnings on ties.
+	Top []MessageCount `json:"top,omitempty"`
+}
+
+// MessageCount counts the messages of an importance sharing their first
+// line, which leaves out e.g. the stack traces of worker startup errors.
+type MessageCount struct {
+	Importance string    `json:"importance"`
+	Text       string    `json:"text"`
+	Count      int       `json:"count"`
+	LastTime   time.Time `json:"last_time"`
+}
+
+// messageSummarizer builds a MessageSummary from the messages observed.
+type messageSummarizer struct {
+	summary MessageSummary
+	counts  map[MessageCount]*MessageCount
+}
+
+func newMessageSummarizer() *messageSummarizer {
+	return &messageSummarizer{counts: map[MessageCount]*MessageCount{}}
+}
+
+func (s *messageSummarizer) observe(m *dataflowpb.JobMessage) {
+	switch m.GetMessageImportance() {
+	case dataflowpb.JobMessageImportance_JOB_MESSAGE_ERROR:
+		s.summary.Errors++
+	case dataflowpb.JobMessageImportance_JOB_MESSAGE_WARNING:
+		s.summary.Warnings++
+	default:
+		return
+	}
+	text, _, _ := strings.Cut(strings.TrimSpace(m.GetMessageText()), "\n")
+	key := MessageCount{Importance: m.GetMessageImportance().String(), Text: text}
+	c, ok := s.counts[key]
+	if !ok {
+		c = &MessageCount{Importance: key.Importance, Text: key.Text}
+		s.counts[key] = c
+	}
+	c.Count++
+	if at := m.GetTime().AsTime(); at.After(c.LastTime) {
+		c.LastTime = at
+	}
+}
+
+// result returns the summary with the most frequent messages.
+func (s *messageSummarizer) result() *MessageSummary {
+	res := s.summary
+	for _, c := range s.counts {
+		res.Top = append(res.Top, *c)
+	}
+	sort.Slice(res.Top, func(i, k int) bool {
+		a, b := res.Top[i], res.Top[k]
+		switch {
+		case a.Count != b.Count:
+			return a.Count > b.Count
+		case a.Importance != b.Importance:
+			return a.Importance < b.Importance
+		}
+		return a.Text < b.Text
+	})
+	if len(res.Top) > maxTopMessages {
+		res.Top = res.Top[:maxTopMessages]
+	}
+	return &res
+}
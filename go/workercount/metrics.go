@@ -0,0 +1,142 @@
+package workercount
+
+import (
+	dataflow "cloud.google.com/go/dataflow/apiv1beta3"
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Names of the job metrics read by Client.JobMetrics, as reported by the
+// Dataflow service. Streaming jobs report system lag and backlog, and
+// Streaming Engine jobs the service resources consumed; every job reports
+// the elements produced per PCollection.
+const (
+	systemLagMetric              = "SystemLag"
+	backlogBytesMetric           = "BacklogBytes"
+	backlogElementsMetric        = "BacklogElements"
+	elementCountMetric           = "ElementCount"
+	streamingEngineUnitsMetric   = "TotalStreamingEngineComputeUnits"
+	streamingDataProcessedMetric = "TotalStreamingDataProcessed"
+)
+
+// JobMetrics are the job metrics reported next to the worker counts when
+// Options.WithMetrics is set. Metrics the job does not report are nil.
+type JobMetrics struct {
+	// MetricTime is when the service last updated the metrics.
+	MetricTime time.Time `json:"metric_time"`
+	// SystemLagSeconds is the longest time an element waited for processing.
+	SystemLagSeconds *float64 `json:"system_lag_seconds,omitempty"`
+	// BacklogBytes and BacklogElements are the unprocessed input, summed
+	// over the job's sources.
+	BacklogBytes    *int64 `json:"backlog_bytes,omitempty"`
+	BacklogElements *int64 `json:"backlog_elements,omitempty"`
+	// Elements is the number of elements produced, summed over the job's
+	// PCollections, and ElementsPerSecond their average rate since the job
+	// started.
+	Elements          *int64   `json:"elements,omitempty"`
+	ElementsPerSecond *float64 `json:"elements_per_second,omitempty"`
+	// StreamingEngineComputeUnits and StreamingDataProcessedBytes are the
+	// Streaming Engine resources consumed since the job started, whichever
+	// its billing model reports.
+	StreamingEngineComputeUnits *float64 `json:"streaming_engine_compute_units,omitempty"`
+	StreamingDataProcessedBytes *int64   `json:"streaming_data_processed_bytes,omitempty"`
+}
+
+// jobMetricsClient returns the Dataflow Metrics client, created on first use
+// as only Options.WithMetrics needs it.
+func (c *Client) jobMetricsClient(ctx context.Context) (*dataflow.MetricsV1Beta3Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.jobMetrics == nil {
+		jobMetrics, err := dataflow.NewMetricsV1Beta3Client(ctx, c.dataflowOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Dataflow Metrics client: %w", err)
+		}
+		c.jobMetrics = jobMetrics
+	}
+	return c.jobMetrics, nil
+}
+
+// JobMetrics returns the job's system lag, backlog and element throughput
+// from GetJobMetrics. Tentative values of failed work are disregarded.
+func (c *Client) JobMetrics(ctx context.Context, projectID, location, jobID string) (*JobMetrics, error) {
+	client, err := c.jobMetricsClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.GetJobMetrics(ctx, &dataflowpb.GetJobMetricsRequest{
+		ProjectId: projectID,
+		Location:  location,
+		JobId:     jobID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("API Error fetching job metrics: %w", err)
+	}
+
+	m := &JobMetrics{MetricTime: resp.GetMetricTime().AsTime()}
+	for _, u := range resp.GetMetrics() {
+		if u.GetName().GetContext()["tentative"] == "true" {
+			continue
+		}
+		v := metricValue(u)
+		switch u.GetName().GetName() {
+		case systemLagMetric:
+			if m.SystemLagSeconds == nil || v > *m.SystemLagSeconds {
+				m.SystemLagSeconds = &v
+			}
+		case backlogBytesMetric:
+			m.BacklogBytes = addMetric(m.BacklogBytes, v)
+		case backlogElementsMetric:
+			m.BacklogElements = addMetric(m.BacklogElements, v)
+		case elementCountMetric:
+			m.Elements = addMetric(m.Elements, v)
+		case streamingEngineUnitsMetric:
+			if m.StreamingEngineComputeUnits != nil {
+				v += *m.StreamingEngineComputeUnits
+			}
+			m.StreamingEngineComputeUnits = &v
+		case streamingDataProcessedMetric:
+			m.StreamingDataProcessedBytes = addMetric(m.StreamingDataProcessedBytes, v)
+		}
+	}
+
+	if m.Elements != nil {
+		job, err := c.jobs.GetJob(ctx, &dataflowpb.GetJobRequest{
+			ProjectId: projectID,
+			Location:  location,
+			JobId:     jobID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("API Error fetching job details: %w", err)
+		}
+		if start := job.GetStartTime().AsTime(); job.GetStartTime() != nil && m.MetricTime.After(start) {
+			rate := float64(*m.Elements) / m.MetricTime.Sub(start).Seconds()
+			m.ElementsPerSecond = &rate
+		}
+	}
+	return m, nil
+}
+
+// metricValue returns the scalar, gauge or mean value of u.
+func metricValue(u *dataflowpb.MetricUpdate) float64 {
+	switch {
+	case u.GetScalar() != nil:
+		return u.GetScalar().GetNumberValue()
+	case u.GetGauge() != nil:
+		return u.GetGauge().GetNumberValue()
+	case u.GetMeanCount().GetNumberValue() > 0:
+		return u.GetMeanSum().GetNumberValue() / u.GetMeanCount().GetNumberValue()
+	}
+	return 0
+}
+
+// addMetric adds v to the sum at acc, which is nil before the first value.
+func addMetric(acc *int64, v float64) *int64 {
+	sum := int64(v)
+	if acc != nil {
+		sum += *acc
+	}
+	return &sum
+}
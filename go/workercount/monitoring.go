@@ -0,0 +1,181 @@
+package workercount
+
+import (
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// SourceMonitoring is the Result.Source of worker counts taken from Cloud
+// Monitoring because no autoscaling events were found.
+const SourceMonitoring = "monitoring"
+
+// Dataflow metrics queried by Client.MonitoredWorkers and
+// Client.WatermarkAge.
+const (
+	currentWorkersMetricType   = "dataflow.googleapis.com/job/current_num_workers"
+	dataWatermarkAgeMetricType = "dataflow.googleapis.com/job/data_watermark_age"
+)
+
+// cpuUtilizationMetricType is the Compute Engine metric queried by
+// Client.WorkerCPU for the VMs labeled with the job's ID.
+const cpuUtilizationMetricType = "compute.googleapis.com/instance/cpu/utilization"
+
+// monitoringLookback is how far back from the end of the window the metric
+// is queried. Dataflow writes it about every minute while the job runs.
+const monitoringLookback = 10 * time.Minute
+
+// metricClient returns the Cloud Monitoring client, created on first use as
+// only fallbacks, watermarks and CPU utilization need it.
+func (c *Client) metricClient(ctx context.Context) (*monitoring.MetricClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metrics == nil {
+		metrics, err := monitoring.NewMetricClient(ctx, c.opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Cloud Monitoring client: %w", err)
+		}
+		c.metrics = metrics
+	}
+	return c.metrics, nil
+}
+
+// MonitoredWorkers returns the latest dataflow.googleapis.com/job/current_num_workers
+// point of the job in the minutes before end, and its time.
+func (c *Client) MonitoredWorkers(ctx context.Context, projectID, jobID string, end time.Time) (int64, time.Time, error) {
+	p, err := c.latestPoint(ctx, projectID, jobID, currentWorkersMetricType, end)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if p == nil {
+		return 0, time.Time{}, errors.New("no " + currentWorkersMetricType + " points found")
+	}
+	return p.GetValue().GetInt64Value(), p.GetInterval().GetEndTime().AsTime(), nil
+}
+
+// WatermarkAge returns the latest dataflow.googleapis.com/job/data_watermark_age
+// of the job in the minutes before end, how far its data watermark lags
+// behind real time, and the time of the point. ok is false if the job
+// reported none, as batch jobs do.
+func (c *Client) WatermarkAge(ctx context.Context, projectID, jobID string, end time.Time) (age time.Duration, at time.Time, ok bool, err error) {
+	p, err := c.latestPoint(ctx, projectID, jobID, dataWatermarkAgeMetricType, end)
+	if err != nil || p == nil {
+		return 0, time.Time{}, false, err
+	}
+	seconds := float64(p.GetValue().GetInt64Value())
+	if _, isDouble := p.GetValue().GetValue().(*monitoringpb.TypedValue_DoubleValue); isDouble {
+		seconds = p.GetValue().GetDoubleValue()
+	}
+	return time.Duration(seconds * float64(time.Second)), p.GetInterval().GetEndTime().AsTime(), true, nil
+}
+
+// CPUUtilization is the CPU utilization of a job's workers over the event
+// window, as fractions between 0 and 1.
+type CPUUtilization struct {
+	// Mean is the mean of the workers' mean utilization.
+	Mean float64 `json:"mean"`
+	// Max is the highest utilization of any worker.
+	Max float64 `json:"max"`
+}
+
+// WorkerCPU returns the CPU utilization of the job's worker VMs between start
+// and end, or nil if none reported any. The window is widened to the minutes
+// before end if shorter, as Compute Engine reports the metric every minute.
+func (c *Client) WorkerCPU(ctx context.Context, projectID, jobID string, start, end time.Time) (*CPUUtilization, error) {
+	if end.Sub(start) < monitoringLookback {
+		start = end.Add(-monitoringLookback)
+	}
+	means, err := c.alignedValues(ctx, projectID, jobID, start, end, monitoringpb.Aggregation_ALIGN_MEAN)
+	if err != nil || len(means) == 0 {
+		return nil, err
+	}
+	maxes, err := c.alignedValues(ctx, projectID, jobID, start, end, monitoringpb.Aggregation_ALIGN_MAX)
+	if err != nil {
+		return nil, err
+	}
+	u := &CPUUtilization{}
+	for _, v := range means {
+		u.Mean += v / float64(len(means))
+	}
+	for _, v := range maxes {
+		u.Max = max(u.Max, v)
+	}
+	return u, nil
+}
+
+// alignedValues returns one value per worker VM of the job, the CPU
+// utilization between start and end aligned with aligner.
+func (c *Client) alignedValues(ctx context.Context, projectID, jobID string, start, end time.Time, aligner monitoringpb.Aggregation_Aligner) ([]float64, error) {
+	metrics, err := c.metricClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	it := metrics.ListTimeSeries(ctx, &monitoringpb.ListTimeSeriesRequest{
+		Name:   "projects/" + projectID,
+		Filter: fmt.Sprintf("metric.type = %q AND resource.type = \"gce_instance\" AND metadata.user_labels.dataflow_job_id = %q", cpuUtilizationMetricType, jobID),
+		Interval: &monitoringpb.TimeInterval{
+			StartTime: timestamppb.New(start),
+			EndTime:   timestamppb.New(end),
+		},
+		Aggregation: &monitoringpb.Aggregation{
+			AlignmentPeriod:  durationpb.New(end.Sub(start).Round(time.Second)),
+			PerSeriesAligner: aligner,
+		},
+		View: monitoringpb.ListTimeSeriesRequest_FULL,
+	})
+	var values []float64
+	for {
+		series, err := it.Next()
+		if err == iterator.Done {
+			return values, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("API Error querying %s: %w", cpuUtilizationMetricType, err)
+		}
+		for _, p := range series.GetPoints() {
+			values = append(values, p.GetValue().GetDoubleValue())
+		}
+	}
+}
+
+// latestPoint returns the latest point of the job's metricType in the
+// minutes before end, or nil if there is none.
+func (c *Client) latestPoint(ctx context.Context, projectID, jobID, metricType string, end time.Time) (*monitoringpb.Point, error) {
+	metrics, err := c.metricClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	it := metrics.ListTimeSeries(ctx, &monitoringpb.ListTimeSeriesRequest{
+		Name:   "projects/" + projectID,
+		Filter: fmt.Sprintf("metric.type = %q AND resource.type = \"dataflow_job\" AND metric.labels.job_id = %q", metricType, jobID),
+		Interval: &monitoringpb.TimeInterval{
+			StartTime: timestamppb.New(end.Add(-monitoringLookback)),
+			EndTime:   timestamppb.New(end),
+		},
+		View: monitoringpb.ListTimeSeriesRequest_FULL,
+	})
+
+	var latest *monitoringpb.Point
+	var at time.Time
+	for {
+		series, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("API Error querying %s: %w", metricType, err)
+		}
+		for _, p := range series.GetPoints() {
+			if t := p.GetInterval().GetEndTime().AsTime(); t.After(at) {
+				latest, at = p, t
+			}
+		}
+	}
+	return latest, nil
+}
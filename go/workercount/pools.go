@@ -0,0 +1,74 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// WorkerPool is a worker pool configured in a job's environment, e.g. the
+// "harness" pool running the pipeline or a "shuffle" pool.
+type WorkerPool struct {
+	Kind        string `json:"kind"`
+	NumWorkers  int64  `json:"num_workers"`
+	MachineType string `json:"machine_type,omitempty"`
+	// MaxNumWorkers is the autoscaling limit of the pool, if configured.
+	MaxNumWorkers int64  `json:"max_num_workers,omitempty"`
+	Zone          string `json:"zone,omitempty"`
+}
+
+func newWorkerPool(p *dataflowpb.WorkerPool) WorkerPool {
+	return WorkerPool{
+		Kind:          p.GetKind(),
+		NumWorkers:    int64(p.GetNumWorkers()),
+		MachineType:   p.GetMachineType(),
+		MaxNumWorkers: int64(p.GetAutoscalingSettings().GetMaxNumWorkers()),
+		Zone:          p.GetZone(),
+	}
+}
+
+// WorkerPools returns the worker pools of kind, or all of them if empty,
+// configured in the job's environment.
+func (c *Client) WorkerPools(ctx context.Context, projectID, location, jobID, kind string) ([]WorkerPool, error) {
+	job, err := c.fullJob(ctx, projectID, location, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return selectPools(job, kind)
+}
+
+// selectPools returns the worker pools of job of kind, or all of them if
+// empty, failing if none has that kind.
+func selectPools(job *dataflowpb.Job, kind string) ([]WorkerPool, error) {
+	var pools []WorkerPool
+	var kinds []string
+	for _, p := range job.GetEnvironment().GetWorkerPools() {
+		kinds = append(kinds, p.GetKind())
+		if kind == "" || p.GetKind() == kind {
+			pools = append(pools, newWorkerPool(p))
+		}
+	}
+	if kind != "" && len(pools) == 0 {
+		return nil, fmt.Errorf("the job has no %q worker pool, only: %s", kind, strings.Join(kinds, ", "))
+	}
+	return pools, nil
+}
+
+// workerPool returns the worker pool of job of kind if given, else its
+// "harness" pool, else its first pool. It is nil without pools.
+func workerPool(job *dataflowpb.Job, kind string) *dataflowpb.WorkerPool {
+	pools := job.GetEnvironment().GetWorkerPools()
+	if kind == "" {
+		kind = "harness"
+	}
+	for _, p := range pools {
+		if p.GetKind() == kind {
+			return p
+		}
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+	return pools[0]
+}
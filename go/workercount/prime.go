@@ -0,0 +1,103 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The service options or experiments enabling Dataflow Prime and Streaming
+// Engine.
+const (
+	primeOption           = "enable_prime"
+	streamingEngineOption = "enable_streaming_engine"
+)
+
+// isPrime reports whether job runs on Dataflow Prime.
+func isPrime(job *dataflowpb.Job) bool {
+	return hasServiceOption(job, primeOption)
+}
+
+// usesStreamingEngine reports whether job is a streaming job running on
+// Streaming Engine, which moves state and shuffling off the worker VMs. The
+// service reports it as service-based shuffle.
+func usesStreamingEngine(job *dataflowpb.Job) bool {
+	if job.GetType() != dataflowpb.JobType_JOB_TYPE_STREAMING {
+		return false
+	}
+	return hasServiceOption(job, streamingEngineOption) ||
+		job.GetEnvironment().GetShuffleMode() == dataflowpb.ShuffleMode_SERVICE_BASED
+}
+
+// hasServiceOption reports whether opt is among the service options or
+// experiments of job.
+func hasServiceOption(job *dataflowpb.Job, opt string) bool {
+	env := job.GetEnvironment()
+	for _, opts := range [][]string{env.GetServiceOptions(), env.GetExperiments()} {
+		for _, o := range opts {
+			if o == opt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	// verticalScalingMessage matches the job messages of Dataflow Prime's
+	// vertical autoscaling and right fitting.
+	verticalScalingMessage = regexp.MustCompile(`(?i)vertical(ly)? autoscal|right[- ]fitting`)
+	// memoryAmount matches memory amounts like "8 GiB" or "7680MB".
+	memoryAmount = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(GiB|GB|MiB|MB)\b`)
+)
+
+// VerticalScalingEvent is a vertical autoscaling or right fitting message of
+// a Dataflow Prime job, which changes the memory of its workers rather than
+// their number.
+type VerticalScalingEvent struct {
+	Time time.Time `json:"time"`
+	// MemoryPerWorkerGB is the memory per worker scaled to, the last amount
+	// the message mentions, if any.
+	MemoryPerWorkerGB *float64 `json:"memory_per_worker_gb,omitempty"`
+	Text              string   `json:"text"`
+}
+
+// verticalScalingTracker collects the vertical scaling events among the
+// messages observed.
+type verticalScalingTracker struct {
+	events []VerticalScalingEvent
+}
+
+func (t *verticalScalingTracker) observe(m *dataflowpb.JobMessage) {
+	text := m.GetMessageText()
+	if !verticalScalingMessage.MatchString(text) {
+		return
+	}
+	e := VerticalScalingEvent{Time: m.GetTime().AsTime(), Text: strings.TrimSpace(text)}
+	if amounts := memoryAmount.FindAllStringSubmatch(text, -1); len(amounts) > 0 {
+		last := amounts[len(amounts)-1]
+		if gb, err := strconv.ParseFloat(last[1], 64); err == nil {
+			if strings.HasPrefix(strings.ToUpper(last[2]), "M") {
+				gb /= 1024
+			}
+			e.MemoryPerWorkerGB = &gb
+		}
+	}
+	t.events = append(t.events, e)
+}
+
+// result returns the events observed, oldest first, and the latest memory
+// per worker they mention, if any.
+func (t *verticalScalingTracker) result() ([]VerticalScalingEvent, *float64) {
+	sort.SliceStable(t.events, func(i, k int) bool { return t.events[i].Time.Before(t.events[k].Time) })
+	var memory *float64
+	for _, e := range t.events {
+		if e.MemoryPerWorkerGB != nil {
+			memory = e.MemoryPerWorkerGB
+		}
+	}
+	return t.events, memory
+}
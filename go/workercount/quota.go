@@ -0,0 +1,113 @@
+package workercount
+
+import (
+	compute "cloud.google.com/go/compute/apiv1"
+	computepb "cloud.google.com/go/compute/apiv1/computepb"
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// inUseAddressesQuota is the regional quota of external IP addresses, one of
+// which every worker with a public IP uses.
+const inUseAddressesQuota = "IN_USE_ADDRESSES"
+
+// Quota is a regional Compute Engine quota the workers of a job use, checked
+// against the maximum number of workers the job may scale to.
+type Quota struct {
+	// Metric is the quota, e.g. "N2_CPUS" or "IN_USE_ADDRESSES".
+	Metric string  `json:"metric"`
+	Region string  `json:"region"`
+	Limit  float64 `json:"limit"`
+	Usage  float64 `json:"usage"`
+	// MaxWorkers is the worker count checked and Needed the quota it uses.
+	// Available is the quota the job can use: the unused quota plus what its
+	// current workers use.
+	MaxWorkers int64   `json:"max_workers"`
+	Needed     float64 `json:"needed"`
+	Available  float64 `json:"available"`
+	Sufficient bool    `json:"sufficient"`
+}
+
+// regionsClient returns the Compute Engine Regions client, created on first
+// use as only Options.CheckQuota needs it.
+func (c *Client) regionsClient(ctx context.Context) (*compute.RegionsClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.regions == nil {
+		regions, err := compute.NewRegionsRESTClient(ctx, c.opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Compute Engine Regions client: %w", err)
+		}
+		c.regions = regions
+	}
+	return c.regions, nil
+}
+
+// checkQuota checks the CPU and external IP quotas of the region the job's
+// workers run in against maxWorkers, or the autoscaling limit of its worker
+// pool of kind if 0. currentWorkers are already counted in the quota usage.
+func (c *Client) checkQuota(ctx context.Context, projectID, location string, job *dataflowpb.Job, kind string, maxWorkers, currentWorkers int64) ([]Quota, error) {
+	pool := workerPool(job, kind)
+	if maxWorkers == 0 {
+		maxWorkers = int64(pool.GetAutoscalingSettings().GetMaxNumWorkers())
+	}
+	if maxWorkers == 0 {
+		return nil, errors.New("cannot check quota: neither max_worker nor the job's maximum number of workers is set")
+	}
+	m, err := ParseMachineType(pool.GetMachineType())
+	if err != nil {
+		return nil, fmt.Errorf("cannot check quota: %w", err)
+	}
+	perWorker := map[string]float64{cpuQuota(m.Name): float64(m.VCPUs)}
+	if pool.GetIpConfiguration() != dataflowpb.WorkerIPAddressConfiguration_WORKER_IP_PRIVATE {
+		perWorker[inUseAddressesQuota] = 1
+	}
+
+	region := job.GetEnvironment().GetWorkerRegion()
+	if region == "" {
+		region = location
+	}
+	client, err := c.regionsClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := client.Get(ctx, &computepb.GetRegionRequest{Project: projectID, Region: region})
+	if err != nil {
+		return nil, fmt.Errorf("API Error fetching the quotas of region %s: %w", region, err)
+	}
+
+	var quotas []Quota
+	for _, q := range r.GetQuotas() {
+		n, ok := perWorker[q.GetMetric()]
+		if !ok {
+			continue
+		}
+		quota := Quota{
+			Metric:     q.GetMetric(),
+			Region:     region,
+			Limit:      q.GetLimit(),
+			Usage:      q.GetUsage(),
+			MaxWorkers: maxWorkers,
+			Needed:     n * float64(maxWorkers),
+			Available:  q.GetLimit() - q.GetUsage() + n*float64(currentWorkers),
+		}
+		quota.Sufficient = quota.Needed <= quota.Available
+		quotas = append(quotas, quota)
+	}
+	return quotas, nil
+}
+
+// cpuQuota returns the regional CPU quota of machineType: the general
+// "CPUS" quota for the N1 and E2 series and the shared-core types, else the
+// quota of its series, e.g. "N2_CPUS".
+func cpuQuota(machineType string) string {
+	series, _, _ := strings.Cut(machineType, "-")
+	switch series {
+	case "n1", "e2", "f1", "g1", "custom":
+		return "CPUS"
+	}
+	return strings.ToUpper(series) + "_CPUS"
+}
@@ -0,0 +1,108 @@
+package workercount
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Defaults of RecommendParams used by the recommend command.
+const (
+	DefaultDrainTime         = 10 * time.Minute
+	DefaultTargetUtilization = 0.8
+)
+
+// RecommendParams are the parameters of the formula used by Recommend.
+type RecommendParams struct {
+	// DrainTime is the time the current backlog should be processed in, on
+	// top of the incoming elements.
+	DrainTime time.Duration
+	// TargetUtilization is the fraction of the measured throughput per
+	// worker planned for, leaving headroom for spikes.
+	TargetUtilization float64
+	// MinWorkers and MaxWorkers clamp the recommendation when positive.
+	MinWorkers, MaxWorkers int64
+}
+
+// Validate reports whether the parameters are usable.
+func (p RecommendParams) Validate() error {
+	if p.DrainTime <= 0 {
+		return fmt.Errorf("drain_time (%v) must be positive", p.DrainTime)
+	}
+	if p.TargetUtilization <= 0 || p.TargetUtilization > 1 {
+		return fmt.Errorf("target_utilization (%g) must be greater than 0 and at most 1", p.TargetUtilization)
+	}
+	return nil
+}
+
+// Recommendation is a worker count suggested by Recommend, with the inputs
+// it is based on.
+type Recommendation struct {
+	CurrentWorkers int64 `json:"current_workers"`
+	// ThroughputPerWorker is the elements processed per second and worker
+	// between the two metric samples.
+	ThroughputPerWorker float64 `json:"throughput_per_worker"`
+	// BacklogElements is the backlog at the second sample, and
+	// BacklogGrowthPerSecond its change per second since the first.
+	BacklogElements        int64   `json:"backlog_elements"`
+	BacklogGrowthPerSecond float64 `json:"backlog_growth_per_second"`
+	// RequiredThroughput is the elements per second needed to keep up with
+	// the input and drain the backlog within RecommendParams.DrainTime.
+	RequiredThroughput float64 `json:"required_throughput"`
+	RecommendedWorkers int64   `json:"recommended_workers"`
+	// Clamped reports whether the minimum or maximum workers changed the
+	// recommendation.
+	Clamped bool `json:"clamped"`
+}
+
+// Recommend suggests a worker count for a job running currentWorkers from two
+// samples of its metrics taken some time apart:
+//
+//	throughput per worker = processed elements per second / current workers
+//	required throughput   = processed elements per second + backlog growth per second + backlog / drain time
+//	recommended workers   = ceil(required throughput / (throughput per worker × target utilization))
+//
+// It is a lightweight advisor next to Dataflow's own autoscaling, e.g. to
+// size a job before a backfill.
+func Recommend(currentWorkers int64, before, after *JobMetrics, p RecommendParams) (*Recommendation, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if currentWorkers <= 0 {
+		return nil, errors.New("the job runs no workers to measure the throughput of")
+	}
+	if before.Elements == nil || after.Elements == nil {
+		return nil, errors.New("the job reports no element counts")
+	}
+	if before.BacklogElements == nil || after.BacklogElements == nil {
+		return nil, errors.New("the job reports no backlog, as only streaming jobs do")
+	}
+	elapsed := after.MetricTime.Sub(before.MetricTime).Seconds()
+	if elapsed <= 0 {
+		return nil, errors.New("the job metrics were not updated between the samples")
+	}
+
+	throughput := float64(*after.Elements-*before.Elements) / elapsed
+	r := &Recommendation{
+		CurrentWorkers:         currentWorkers,
+		ThroughputPerWorker:    throughput / float64(currentWorkers),
+		BacklogElements:        *after.BacklogElements,
+		BacklogGrowthPerSecond: float64(*after.BacklogElements-*before.BacklogElements) / elapsed,
+	}
+	if r.ThroughputPerWorker <= 0 {
+		return nil, errors.New("the job processed no elements between the samples")
+	}
+	r.RequiredThroughput = max(throughput+r.BacklogGrowthPerSecond+float64(r.BacklogElements)/p.DrainTime.Seconds(), 0)
+
+	workers := max(int64(math.Ceil(r.RequiredThroughput/(r.ThroughputPerWorker*p.TargetUtilization))), 1)
+	clamped := workers
+	if p.MinWorkers > 0 && clamped < p.MinWorkers {
+		clamped = p.MinWorkers
+	}
+	if p.MaxWorkers > 0 && clamped > p.MaxWorkers {
+		clamped = p.MaxWorkers
+	}
+	r.RecommendedWorkers, r.Clamped = clamped, clamped != workers
+	return r, nil
+}
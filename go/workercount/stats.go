@@ -0,0 +1,240 @@
+package workercount
+
+import (
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported Options.Stat values.
+const (
+	StatAvg = "avg"
+	StatMax = "max"
+	StatMin = "min"
+)
+
+// Directions reported by Result.Trend.
+const (
+	TrendUp     = "up"
+	TrendDown   = "down"
+	TrendStable = "stable"
+)
+
+// ValidateStat reports whether stat is a supported Options.Stat: one of the
+// Stat constants or a percentile like "p95".
+func ValidateStat(stat string) error {
+	switch stat {
+	case "", StatAvg, StatMax, StatMin:
+		return nil
+	}
+	if _, ok := parsePercentile(stat); ok {
+		return nil
+	}
+	return fmt.Errorf("stat must be %q, %q, %q or a percentile like 'p95', got %q", StatAvg, StatMax, StatMin, stat)
+}
+
+// parsePercentile returns the percentile of a stat like "p95" or "p99.9".
+func parsePercentile(stat string) (float64, bool) {
+	if !strings.HasPrefix(stat, "p") {
+		return 0, false
+	}
+	q, err := strconv.ParseFloat(stat[1:], 64)
+	if err != nil || !(q >= 0 && q <= 100) {
+		return 0, false
+	}
+	return q, true
+}
+
+// workerSample is a worker count reported at a time.
+type workerSample struct {
+	time    time.Time
+	workers int64
+}
+
+// currentSamples returns the current worker counts reported by events,
+// oldest first.
+func currentSamples(events []*dataflowpb.AutoscalingEvent) []workerSample {
+	var samples []workerSample
+	for _, e := range events {
+		if e.GetCurrentNumWorkers() > 0 {
+			samples = append(samples, workerSample{e.GetTime().AsTime(), e.GetCurrentNumWorkers()})
+		}
+	}
+	sort.SliceStable(samples, func(i, k int) bool { return samples[i].time.Before(samples[k].time) })
+	return samples
+}
+
+// holdTimes returns how long each of samples held, until the next one or
+// end. The worker count before the first sample is unknown, so that part of
+// the window is left out of time-weighted statistics.
+func holdTimes(samples []workerSample, end time.Time) []time.Duration {
+	held := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		until := end
+		if i+1 < len(samples) {
+			until = samples[i+1].time
+		}
+		held[i] = max(until.Sub(s.time), 0)
+	}
+	return held
+}
+
+// workerHours returns the worker hours of samples until end and the part of
+// the window they cover.
+func workerHours(samples []workerSample, end time.Time) (float64, time.Duration) {
+	var hours float64
+	var covered time.Duration
+	for i, d := range holdTimes(samples, end) {
+		hours += float64(samples[i].workers) * d.Hours()
+		covered += d
+	}
+	return hours, covered
+}
+
+// timeWeightedMean returns the mean of samples, each weighted by how long it
+// held.
+func timeWeightedMean(samples []workerSample, end time.Time) float64 {
+	var weighted, total float64
+	for i, d := range holdTimes(samples, end) {
+		weighted += float64(samples[i].workers) * d.Seconds()
+		total += d.Seconds()
+	}
+	if total <= 0 {
+		return float64(samples[len(samples)-1].workers)
+	}
+	return weighted / total
+}
+
+// timeWeightedPercentile returns the worker count at or below which the job
+// ran for q percent of the time covered by samples.
+func timeWeightedPercentile(samples []workerSample, end time.Time, q float64) float64 {
+	held := holdTimes(samples, end)
+	order := make([]int, len(samples))
+	var total time.Duration
+	for i := range order {
+		order[i] = i
+		total += held[i]
+	}
+	if total <= 0 {
+		return float64(samples[len(samples)-1].workers)
+	}
+	sort.SliceStable(order, func(i, k int) bool { return samples[order[i]].workers < samples[order[k]].workers })
+
+	rank := q / 100 * total.Seconds()
+	var acc float64
+	for _, i := range order {
+		acc += held[i].Seconds()
+		if acc >= rank && held[i] > 0 {
+			return float64(samples[i].workers)
+		}
+	}
+	return float64(samples[order[len(order)-1]].workers)
+}
+
+// peakWorkers returns the largest current and, if checkTarget, target worker
+// count reported by events.
+func peakWorkers(events []*dataflowpb.AutoscalingEvent, checkTarget bool) int64 {
+	var peak int64
+	for _, e := range events {
+		peak = max(peak, e.GetCurrentNumWorkers())
+		if checkTarget {
+			peak = max(peak, e.GetTargetNumWorkers())
+		}
+	}
+	return peak
+}
+
+// computeStat computes stat over the events of the window ending at end. It
+// returns false if no event reports a worker count.
+func computeStat(stat string, events []*dataflowpb.AutoscalingEvent, end time.Time, checkTarget bool) (float64, bool) {
+	if stat == StatMax {
+		peak := peakWorkers(events, checkTarget)
+		return float64(peak), peak > 0
+	}
+	samples := currentSamples(events)
+	if len(samples) == 0 {
+		return 0, false
+	}
+	if stat == StatMin {
+		lowest := samples[0].workers
+		for _, s := range samples {
+			lowest = min(lowest, s.workers)
+		}
+		return float64(lowest), true
+	}
+	if q, ok := parsePercentile(stat); ok {
+		return timeWeightedPercentile(samples, end, q), true
+	}
+	return timeWeightedMean(samples, end), true
+}
+
+// workerSlope returns the least-squares slope of samples in workers per
+// minute, or 0 with fewer than two distinct sample times.
+func workerSlope(samples []workerSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	origin := samples[0].time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.time.Sub(origin).Minutes()
+		y := float64(s.workers)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denom
+}
+
+// workerTrend classifies where the worker count is heading. A target that
+// differs from the current workers means the job is scaling right now;
+// otherwise the slope of samples decides, if it adds up to at least one
+// worker between the first sample and end.
+func workerTrend(samples []workerSample, current, target int64, end time.Time) string {
+	switch {
+	case target > 0 && target > current:
+		return TrendUp
+	case target > 0 && target < current:
+		return TrendDown
+	case len(samples) == 0:
+		return TrendStable
+	}
+	change := workerSlope(samples) * end.Sub(samples[0].time).Minutes()
+	switch {
+	case change >= 1:
+		return TrendUp
+	case change <= -1:
+		return TrendDown
+	}
+	return TrendStable
+}
+
+// WorkerDuration is how long a job ran at a worker count.
+type WorkerDuration struct {
+	Workers int64   `json:"workers"`
+	Seconds float64 `json:"seconds"`
+}
+
+// workerHistogram returns how long samples held each worker count, ordered by
+// worker count.
+func workerHistogram(samples []workerSample, end time.Time) []WorkerDuration {
+	held := map[int64]time.Duration{}
+	for i, d := range holdTimes(samples, end) {
+		held[samples[i].workers] += d
+	}
+	histogram := make([]WorkerDuration, 0, len(held))
+	for workers, d := range held {
+		histogram = append(histogram, WorkerDuration{Workers: workers, Seconds: d.Seconds()})
+	}
+	sort.Slice(histogram, func(i, k int) bool { return histogram[i].Workers < histogram[k].Workers })
+	return histogram
+}
@@ -0,0 +1,148 @@
+package workercount
+
+import (
+	"context"
+	gax "github.com/googleapis/gax-go/v2"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"log"
+	"time"
+)
+
+// Backoff between the retries of Retry: exponential from initialRetryBackoff,
+// doubling up to maxRetryBackoff, with jitter.
+const (
+	initialRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// RequestTimeout returns a client option bounding each call to the gRPC APIs
+// used by a Client, like GetJob or each page of ListJobMessages, to d, so a
+// hung call fails instead of blocking forever. Calls whose context already
+// has an earlier deadline keep it.
+func RequestTimeout(d time.Duration) option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+	))
+}
+
+// Retry returns a client option retrying the calls to the gRPC APIs used by a
+// Client that fail with a transient error, up to maxRetries times with
+// exponential backoff, as long as maxElapsed has not passed since the first
+// attempt. A maxElapsed of 0 does not limit the time spent retrying. Given
+// before RequestTimeout, every attempt gets its own timeout.
+func Retry(maxRetries int, maxElapsed time.Duration) option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			start := time.Now()
+			backoff := gax.Backoff{Initial: initialRetryBackoff, Max: maxRetryBackoff, Multiplier: 2}
+			for retries := 0; ; retries++ {
+				err := invoker(ctx, method, req, reply, cc, opts...)
+				if err == nil || retries == maxRetries || !IsTransient(err) || ctx.Err() != nil {
+					return err
+				}
+				pause := backoff.Pause()
+				if maxElapsed > 0 && time.Since(start)+pause > maxElapsed {
+					return err
+				}
+				if gax.Sleep(ctx, pause) != nil {
+					return err
+				}
+			}
+		},
+	))
+}
+
+// IsTransient reports whether err is a transient gRPC error worth retrying:
+// an unavailable service, a call that timed out or exhausted quota.
+func IsTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// RateLimit returns a client option limiting the calls to the gRPC APIs used
+// by a Client to qps per second on average, in bursts of up to burst calls.
+// The limit is shared by every client created with the same option, so
+// concurrent lookups of many jobs stay within the API quota; each call of
+// RateLimit starts a separate limit. Given after Retry, every retry waits for
+// its turn too.
+//
+// Like Retry and RequestTimeout, it does not apply to the Compute Engine REST
+// clients of Options.CheckQuota and Options.VerifyInstances.
+func RateLimit(qps float64, burst int) option.ClientOption {
+	limiter := rate.NewLimiter(rate.Limit(qps), burst)
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+	))
+}
+
+// maxDebugSummary is the length past which DebugLogging truncates requests.
+const maxDebugSummary = 200
+
+// DebugLogging returns a client option logging every call to the gRPC APIs
+// used by a Client: its method, a one-line summary of the request, the size
+// of the response in bytes or the error, and its latency. Given after Retry,
+// every attempt is logged.
+func DebugLogging() option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			start := time.Now()
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			latency := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				log.Printf("DEBUG: grpc %s {%s}: %v after %v", method, summarize(req), err, latency)
+				return err
+			}
+			size := 0
+			if m, ok := reply.(proto.Message); ok {
+				size = proto.Size(m)
+			}
+			log.Printf("DEBUG: grpc %s {%s}: %d bytes in %v", method, summarize(req), size, latency)
+			return err
+		},
+	))
+}
+
+// summarize returns the request req as single-line text, truncated to
+// maxDebugSummary bytes.
+func summarize(req any) string {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return ""
+	}
+	s := prototext.MarshalOptions{}.Format(m)
+	if len(s) > maxDebugSummary {
+		s = s[:maxDebugSummary] + "..."
+	}
+	return s
+}
+
+// KeepAlive returns a client option pinging the gRPC APIs used by a Client
+// after interval without activity, even between calls, so a long-running
+// process reusing its Client across polls detects a dropped connection and
+// reconnects before the next call rather than failing it.
+func KeepAlive(interval time.Duration) option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithKeepaliveParams(keepalive.ClientParameters{
+		Time:                interval,
+		Timeout:             interval / 3,
+		PermitWithoutStream: true,
+	}))
+}
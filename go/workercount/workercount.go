@@ -0,0 +1,1078 @@
+// Package workercount determines the latest desired worker count for a
+// Dataflow job from the autoscaling events reported in its job messages.
+//
+// The same logic backs the dataflow_worker_count command line tool and the
+// HTTP handler exposed for Cloud Functions / Cloud Run deployments.
+package workercount
+
+import (
+	compute "cloud.google.com/go/compute/apiv1"
+	dataflow "cloud.google.com/go/dataflow/apiv1beta3"
+	dataflowpb "cloud.google.com/go/dataflow/apiv1beta3/dataflowpb"
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoEvents is returned by Client.Fetch when no autoscaling events with a
+// current or target worker count exist in the requested window.
+var ErrNoEvents = errors.New("no autoscaling events with current or target worker counts found")
+
+// ErrUnexpectedState is returned by Client.Fetch when the job is not in
+// Options.RequireState.
+var ErrUnexpectedState = errors.New("job is not in the required state")
+
+// SourceJobConfig is the Result.Source of worker counts taken from the job's
+// configuration because no autoscaling events were found.
+const SourceJobConfig = "job_config"
+
+// DefaultMaxLookback caps the window widened by Options.AutoExpandLookback
+// unless Options.MaxLookback is set.
+const DefaultMaxLookback = 24 * time.Hour
+
+// firstScanSlice is the length of the newest part of the event window
+// scanned first; each older slice is twice as long as the previous one.
+const firstScanSlice = 5 * time.Minute
+
+// waitPollInterval is how often Client.WaitForState and Options.WaitStable
+// poll the job.
+const waitPollInterval = 10 * time.Second
+
+// lookbackSteps are the lookbacks tried in turn by Options.AutoExpandLookback.
+var lookbackSteps = []time.Duration{5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 24 * time.Hour}
+
+// Options describes the job to inspect and how to compute its desired workers.
+type Options struct {
+	ProjectID string
+	Location  string
+	JobID     string
+	// JobName selects the most recently created active job with this name
+	// when JobID is empty, so callers need not track job IDs across relaunches.
+	// It is reported in the Result either way.
+	JobName string
+	// TemplatePath selects the most recently created active job launched
+	// from this classic template or flex template spec file when JobID and
+	// JobName are empty.
+	TemplatePath string
+
+	// TimeDeltaMinutes is how far back from EndTime to look for autoscaling
+	// events.
+	TimeDeltaMinutes int
+	// Lookback replaces TimeDeltaMinutes with a finer or coarser duration
+	// when positive.
+	Lookback time.Duration
+	// StartTime starts the event window at an absolute time instead of
+	// TimeDeltaMinutes before its end.
+	StartTime time.Time
+	// EndTime ends the event window; the zero value means now.
+	EndTime time.Time
+	// AutoExpandLookback widens the lookback step by step, e.g. from 5
+	// minutes to 30 minutes, 2 hours and 24 hours, until events are found
+	// instead of failing with ErrNoEvents.
+	AutoExpandLookback bool
+	// MaxLookback caps the lookback widened by AutoExpandLookback; zero means
+	// DefaultMaxLookback.
+	MaxLookback time.Duration
+	// MinImportance is the minimum importance of the job messages listed,
+	// e.g. "detailed" or "JOB_MESSAGE_DEBUG" for jobs reporting autoscaling
+	// context at lower levels; empty means "basic".
+	MinImportance string
+	// PageSize is the number of job messages requested per page; zero leaves
+	// it to the API. Larger pages need fewer round trips on chatty jobs.
+	PageSize int32
+	// EventTypes restricts the events considered to these autoscaling event
+	// types, e.g. "TARGET_NUM_WORKERS_CHANGED"; empty means every type.
+	EventTypes []string
+	// MaxEvents stops the scan after this many autoscaling events when
+	// positive, bounding the work spent on jobs with enormous histories.
+	MaxEvents int
+	// Cooldown disregards target worker counts reported less than this
+	// before the end of the window, which Dataflow may still revise.
+	Cooldown time.Duration
+	// Stat additionally computes a statistic of the worker counts over the
+	// whole window, e.g. StatAvg, which disables the early end of the scan.
+	Stat string
+	// Trend reports whether the worker count is trending up, down or stable
+	// over the window, which disables the early end of the scan.
+	Trend bool
+	// Rate reports the workers added per minute over the window, which
+	// disables the early end of the scan.
+	Rate bool
+	// Histogram reports how long the job ran at each current worker count
+	// within the window, which disables the early end of the scan.
+	Histogram bool
+	// IncludeEvents lists every autoscaling event considered in the window
+	// in the Result, which disables the early end of the scan.
+	IncludeEvents bool
+	// WatermarkAge additionally reports how far the data watermark of a
+	// streaming job lags behind real time, from Cloud Monitoring.
+	WatermarkAge bool
+	// JobDetails additionally reports details from the job's full view, like
+	// its FlexRS goal, whether it runs on Dataflow Prime or Streaming
+	// Engine, its type, create and start time, SDK and runner, and its
+	// autoscaling pipeline options.
+	JobDetails bool
+	// Resources additionally reports the machine type of the job's workers,
+	// of Pool if set, and the vCPUs, memory and GPUs implied by the desired
+	// workers.
+	Resources bool
+	// EstimateCost additionally reports the approximate hourly cost of the
+	// desired workers, based on their machine type and Prices.
+	EstimateCost bool
+	// WindowCost additionally reports the worker hours of the window and
+	// their estimated cost, which implies EstimateCost and disables the
+	// early end of the scan.
+	WindowCost bool
+	// CheckQuota additionally checks the regional CPU and external IP quotas
+	// against MaxWorker, or the autoscaling limit of the job's workers if 0,
+	// times the quota used per worker.
+	CheckQuota bool
+	// VerifyInstances additionally counts the Compute Engine instances of
+	// the job's workers and flags divergence from the current workers.
+	VerifyInstances bool
+	// MaxHourlyCost flags results whose estimated hourly cost exceeds it,
+	// which implies EstimateCost. Disabled when 0.
+	MaxHourlyCost float64
+	// Prices are the prices used by EstimateCost. Defaults to DefaultPrices.
+	Prices *Prices
+	// WorkerCPU additionally reports the mean and maximum CPU utilization of
+	// the job's workers over the window, from Cloud Monitoring.
+	WorkerCPU bool
+	// WithMetrics additionally reports the job's system lag, backlog and
+	// element throughput from the Dataflow job metrics.
+	WithMetrics bool
+	// VerticalScaling lists the vertical autoscaling and right fitting
+	// messages of Dataflow Prime jobs found during the same scan, which
+	// disables the early end of the scan.
+	VerticalScaling bool
+	// SummarizeMessages counts the error and warning messages of the window
+	// found during the same scan, which disables the early end of the scan.
+	// MinImportance must include them.
+	SummarizeMessages bool
+	// MonitoringFallback reports the job's latest
+	// dataflow.googleapis.com/job/current_num_workers metric from Cloud
+	// Monitoring instead of failing with ErrNoEvents.
+	MonitoringFallback bool
+	// JobConfigFallback reports the number of workers configured in the
+	// job's environment, in Pool if set, instead of failing with ErrNoEvents.
+	JobConfigFallback bool
+	// Pools additionally reports the worker pools configured in the job's
+	// environment, e.g. the "harness" and "shuffle" pools.
+	Pools bool
+	// Pool restricts the worker pools reported, and those counted by
+	// JobConfigFallback, to this kind, e.g. "harness".
+	Pool string
+	// MaxEventAge marks the Result as Stale when positive and its newest
+	// autoscaling event is older than this at the end of the window.
+	MaxEventAge time.Duration
+	// MinWorker and MaxWorker clamp the desired workers when greater than zero.
+	MinWorker int64
+	MaxWorker int64
+	// FetchJobStatus additionally fetches the job's current state.
+	FetchJobStatus bool
+	// RequireState fails the lookup with ErrUnexpectedState before any
+	// message is scanned unless the job is in this state, e.g.
+	// "JOB_STATE_RUNNING".
+	RequireState string
+	// WaitForState polls the job until it is in this state, e.g.
+	// "JOB_STATE_RUNNING", before looking for events.
+	WaitForState string
+	// WaitStable repeats the lookup until the current workers are within
+	// StableTolerance of the target workers, e.g. until a scale-up completed.
+	WaitStable      bool
+	StableTolerance int64
+	// WaitTimeout gives up on WaitForState and WaitStable after this long
+	// when positive.
+	WaitTimeout time.Duration
+	// ZeroIfTerminal reports zero workers without looking for events if the
+	// job is in a terminal state, e.g. JOB_STATE_DONE.
+	ZeroIfTerminal bool
+	// CheckTargetWorkers considers target workers when determining desired
+	// workers, useful if the upscale event has not been actuated yet.
+	CheckTargetWorkers bool
+	// IgnoreDownscale disregards a latest target worker count smaller than
+	// the latest current worker count, for callers only acting on scale-ups.
+	IgnoreDownscale bool
+	// Checkpoint, the Result.Checkpoint of an earlier lookup of the same
+	// job, restricts the scan to the messages reported since its events,
+	// which still count if no newer events are found. It is ignored for
+	// windows ending at EndTime and by options needing every event of the
+	// window, like Stat.
+	Checkpoint *Checkpoint
+}
+
+// Validate reports whether the options describe a valid lookup.
+func (o *Options) Validate() error {
+	if o.ProjectID == "" || o.Location == "" || (o.JobID == "" && o.JobName == "" && o.TemplatePath == "") {
+		return errors.New("project_id, location, and job_id, job_name or template_path are required")
+	}
+	if o.MinWorker < 0 {
+		return fmt.Errorf("min_worker (%d) cannot be negative", o.MinWorker)
+	}
+	if o.MaxWorker < 0 {
+		return fmt.Errorf("max_worker (%d) cannot be negative", o.MaxWorker)
+	}
+	if o.MinWorker > 0 && o.MaxWorker > 0 && o.MinWorker > o.MaxWorker {
+		return fmt.Errorf("min_worker (%d) cannot be greater than max_worker (%d)", o.MinWorker, o.MaxWorker)
+	}
+	if o.TimeDeltaMinutes < 0 {
+		return fmt.Errorf("time_delta_minutes (%d) cannot be negative", o.TimeDeltaMinutes)
+	}
+	if o.Lookback < 0 {
+		return fmt.Errorf("lookback (%v) cannot be negative", o.Lookback)
+	}
+	if o.Lookback > 0 && o.TimeDeltaMinutes > 0 {
+		return errors.New("lookback and time_delta_minutes are mutually exclusive")
+	}
+	if !o.StartTime.IsZero() && o.lookback() > 0 {
+		return errors.New("start_time is mutually exclusive with time_delta_minutes and lookback")
+	}
+	if _, err := ParseImportance(o.MinImportance); err != nil {
+		return err
+	}
+	if _, err := ParseEventTypes(o.EventTypes); err != nil {
+		return err
+	}
+	if _, err := ParseJobState(o.RequireState); err != nil {
+		return fmt.Errorf("require_state: %w", err)
+	}
+	if _, err := ParseJobState(o.WaitForState); err != nil {
+		return fmt.Errorf("wait_for_state: %w", err)
+	}
+	if o.StableTolerance < 0 {
+		return fmt.Errorf("stable_tolerance (%d) cannot be negative", o.StableTolerance)
+	}
+	if o.WaitTimeout < 0 {
+		return fmt.Errorf("wait_timeout (%v) cannot be negative", o.WaitTimeout)
+	}
+	if o.MaxHourlyCost < 0 {
+		return fmt.Errorf("max_hourly_cost (%g) cannot be negative", o.MaxHourlyCost)
+	}
+	if o.MaxEvents < 0 {
+		return fmt.Errorf("max_events (%d) cannot be negative", o.MaxEvents)
+	}
+	if o.PageSize < 0 {
+		return fmt.Errorf("page_size (%d) cannot be negative", o.PageSize)
+	}
+	if err := ValidateStat(o.Stat); err != nil {
+		return err
+	}
+	if o.Cooldown < 0 {
+		return fmt.Errorf("cooldown (%v) cannot be negative", o.Cooldown)
+	}
+	if o.MaxEventAge < 0 {
+		return fmt.Errorf("max_event_age (%v) cannot be negative", o.MaxEventAge)
+	}
+	if o.MaxLookback < 0 {
+		return fmt.Errorf("max_lookback (%v) cannot be negative", o.MaxLookback)
+	}
+	if o.AutoExpandLookback && !o.StartTime.IsZero() {
+		return errors.New("auto_expand_lookback cannot be combined with start_time")
+	}
+	if !o.StartTime.IsZero() && !o.EndTime.IsZero() && !o.StartTime.Before(o.EndTime) {
+		return fmt.Errorf("start_time (%s) must be before end_time (%s)", o.StartTime.Format(time.RFC3339), o.EndTime.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ParseImportance parses a job message importance like "detailed" or
+// "JOB_MESSAGE_DETAILED", case-insensitively. Empty means JOB_MESSAGE_BASIC.
+func ParseImportance(name string) (dataflowpb.JobMessageImportance, error) {
+	if name == "" {
+		return dataflowpb.JobMessageImportance_JOB_MESSAGE_BASIC, nil
+	}
+	key := strings.ToUpper(name)
+	if !strings.HasPrefix(key, "JOB_MESSAGE_") {
+		key = "JOB_MESSAGE_" + key
+	}
+	v, ok := dataflowpb.JobMessageImportance_value[key]
+	if !ok || v == int32(dataflowpb.JobMessageImportance_JOB_MESSAGE_IMPORTANCE_UNKNOWN) {
+		return 0, fmt.Errorf("min_importance must be 'debug', 'detailed', 'basic', 'warning' or 'error', got %q", name)
+	}
+	return dataflowpb.JobMessageImportance(v), nil
+}
+
+// ParseJobState parses a job state like "running" or "JOB_STATE_RUNNING",
+// case-insensitively, into its full name. Empty is returned as is.
+func ParseJobState(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	key := strings.ToUpper(name)
+	if !strings.HasPrefix(key, "JOB_STATE_") {
+		key = "JOB_STATE_" + key
+	}
+	v, ok := dataflowpb.JobState_value[key]
+	if !ok || v == int32(dataflowpb.JobState_JOB_STATE_UNKNOWN) {
+		return "", fmt.Errorf("invalid job state %q: expected e.g. 'JOB_STATE_RUNNING' or 'running'", name)
+	}
+	return key, nil
+}
+
+// ParseEventTypes parses autoscaling event type names like
+// "CURRENT_NUM_WORKERS_CHANGED", case-insensitively. No names yields nil,
+// meaning every type.
+func ParseEventTypes(names []string) (map[dataflowpb.AutoscalingEvent_AutoscalingEventType]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	types := map[dataflowpb.AutoscalingEvent_AutoscalingEventType]bool{}
+	for _, name := range names {
+		v, ok := dataflowpb.AutoscalingEvent_AutoscalingEventType_value[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown event type %q: expected one of TARGET_NUM_WORKERS_CHANGED, CURRENT_NUM_WORKERS_CHANGED, ACTUATION_FAILURE or NO_CHANGE", name)
+		}
+		types[dataflowpb.AutoscalingEvent_AutoscalingEventType(v)] = true
+	}
+	return types, nil
+}
+
+// Window returns the event window ending at EndTime, or now if unset.
+func (o *Options) Window(now time.Time) (start, end time.Time) {
+	end = now
+	if !o.EndTime.IsZero() {
+		end = o.EndTime
+	}
+	if !o.StartTime.IsZero() {
+		return o.StartTime, end
+	}
+	return end.Add(-o.lookback()), end
+}
+
+// lookback returns how far back from the window's end to look for events.
+func (o *Options) lookback() time.Duration {
+	if o.Lookback > 0 {
+		return o.Lookback
+	}
+	return time.Duration(o.TimeDeltaMinutes) * time.Minute
+}
+
+// nextLookback returns the lookback to try after one without events, or
+// false once the cap was reached.
+func (o *Options) nextLookback() (time.Duration, bool) {
+	limit := o.MaxLookback
+	if limit == 0 {
+		limit = DefaultMaxLookback
+	}
+	current := o.lookback()
+	if current >= limit {
+		return 0, false
+	}
+	for _, step := range lookbackSteps {
+		if step > current {
+			return min(step, limit), true
+		}
+	}
+	return limit, true
+}
+
+// describeLookback formats the lookback like the option that set it.
+func (o *Options) describeLookback() string {
+	if o.Lookback > 0 {
+		return o.Lookback.String()
+	}
+	return fmt.Sprintf("%d minute(s)", o.TimeDeltaMinutes)
+}
+
+// DescribeWindow describes the event window for messages, e.g. "in the last
+// 5 minute(s)", with times in UTC.
+func (o *Options) DescribeWindow() string {
+	return o.DescribeWindowIn(time.UTC)
+}
+
+// DescribeWindowIn is DescribeWindow with times in loc.
+func (o *Options) DescribeWindowIn(loc *time.Location) string {
+	switch {
+	case !o.StartTime.IsZero() && o.EndTime.IsZero():
+		return fmt.Sprintf("since %s", o.StartTime.In(loc).Format(time.RFC3339))
+	case !o.StartTime.IsZero():
+		return fmt.Sprintf("between %s and %s", o.StartTime.In(loc).Format(time.RFC3339), o.EndTime.In(loc).Format(time.RFC3339))
+	case o.EndTime.IsZero():
+		return fmt.Sprintf("in the last %s", o.describeLookback())
+	}
+	return fmt.Sprintf("in the %s before %s", o.describeLookback(), o.EndTime.In(loc).Format(time.RFC3339))
+}
+
+// Job returns JobID, or JobName or TemplatePath when the job is looked up
+// by name or template.
+func (o *Options) Job() string {
+	switch {
+	case o.JobID != "":
+		return o.JobID
+	case o.JobName != "":
+		return o.JobName
+	}
+	return o.TemplatePath
+}
+
+// Result holds the worker counts determined for a job.
+type Result struct {
+	ProjectID string `json:"project_id"`
+	Location  string `json:"location"`
+	JobID     string `json:"job_id"`
+	// JobName is Options.JobName, or the job's name when it was looked up by
+	// Options.TemplatePath.
+	JobName string `json:"job_name,omitempty"`
+	// JobStatus is "N/A" unless Options.FetchJobStatus, ZeroIfTerminal,
+	// RequireState or WaitForState was set.
+	JobStatus string `json:"job_status"`
+	// JobType is "JOB_TYPE_BATCH" or "JOB_TYPE_STREAMING" if the job status
+	// was fetched.
+	JobType        string `json:"job_type,omitempty"`
+	CurrentWorkers int64  `json:"current_workers"`
+	TargetWorkers  int64  `json:"target_workers"`
+	MinWorkers     int64  `json:"min_workers"`
+	MaxWorkers     int64  `json:"max_workers"`
+	DesiredWorkers int64  `json:"desired_workers"`
+	// Clamped reports whether MinWorkers or MaxWorkers changed the desired workers.
+	Clamped bool `json:"clamped"`
+	// Window describes the event window the counts were found in when
+	// Options.AutoExpandLookback had to widen it, e.g. "in the last 2h0m0s".
+	Window string `json:"window,omitempty"`
+	// Source is SourceMonitoring or SourceJobConfig if the worker counts do
+	// not come from autoscaling events.
+	Source string `json:"source,omitempty"`
+	// CurrentEventDescription and TargetEventDescription are the rationale
+	// Dataflow gave for the events the current and target workers are taken
+	// from, e.g. "Raised the number of workers to 50 based on backlog".
+	CurrentEventDescription string `json:"current_event_description,omitempty"`
+	TargetEventDescription  string `json:"target_event_description,omitempty"`
+	// LatestEventTime is the time of the newest autoscaling event the worker
+	// counts are based on.
+	LatestEventTime time.Time `json:"latest_event_time"`
+	// Stale reports that LatestEventTime is older than Options.MaxEventAge.
+	Stale bool `json:"stale,omitempty"`
+	// Stat is Options.Stat, and StatWorkers its value over the window unless
+	// no event in the window reported a worker count.
+	Stat        string   `json:"stat,omitempty"`
+	StatWorkers *float64 `json:"stat_workers,omitempty"`
+	// Trend is TrendUp, TrendDown or TrendStable if Options.Trend was set.
+	Trend string `json:"trend,omitempty"`
+	// WorkersPerMinute is the least-squares slope of the current workers
+	// over the window if Options.Rate was set, negative when scaling down.
+	WorkersPerMinute *float64 `json:"workers_per_minute,omitempty"`
+	// Histogram is how long the job ran at each current worker count within
+	// the window if Options.Histogram was set, ordered by worker count.
+	Histogram []WorkerDuration `json:"histogram,omitempty"`
+	// Events are the autoscaling events considered in the window, oldest
+	// first, if Options.IncludeEvents was set.
+	Events []Event `json:"events,omitempty"`
+	// Messages summarizes the error and warning messages of the window if
+	// Options.SummarizeMessages was set.
+	Messages *MessageSummary `json:"messages,omitempty"`
+	// WatermarkAgeSeconds is the age of the job's data watermark at the end
+	// of the window if Options.WatermarkAge was set and the job reports one.
+	WatermarkAgeSeconds *float64 `json:"watermark_age_seconds,omitempty"`
+	// FlexRSGoal is the flexible resource scheduling goal of a FlexRS job,
+	// e.g. "FLEXRS_COST_OPTIMIZED", if Options.JobDetails was set. FlexRS
+	// jobs may start hours after their launch.
+	FlexRS     bool   `json:"flexrs,omitempty"`
+	FlexRSGoal string `json:"flexrs_goal,omitempty"`
+	// Prime reports whether the job runs on Dataflow Prime if
+	// Options.JobDetails was set.
+	Prime bool `json:"prime,omitempty"`
+	// StreamingEngine reports whether the job runs on Streaming Engine if
+	// Options.JobDetails was set. The compute units it consumed are among
+	// the Metrics.
+	StreamingEngine bool `json:"streaming_engine,omitempty"`
+	// Metadata is the job's metadata if Options.JobDetails was set.
+	Metadata *JobMetadata `json:"metadata,omitempty"`
+	// AutoscalingOptions are the job's pipeline options governing
+	// autoscaling if Options.JobDetails was set.
+	AutoscalingOptions *AutoscalingOptions `json:"autoscaling_options,omitempty"`
+	// VerticalScaling are the vertical scaling events of the window, oldest
+	// first, and MemoryPerWorkerGB the latest memory per worker they mention,
+	// if Options.VerticalScaling was set.
+	VerticalScaling   []VerticalScalingEvent `json:"vertical_scaling,omitempty"`
+	MemoryPerWorkerGB *float64               `json:"memory_per_worker_gb,omitempty"`
+	// MachineType is the machine type of the job's workers if
+	// Options.Resources was set, and Resources the resources implied by the
+	// desired workers unless the machine type is unknown.
+	MachineType string     `json:"machine_type,omitempty"`
+	Resources   *Resources `json:"resources,omitempty"`
+	// GPUs are the GPUs of the desired workers if Options.Resources was set
+	// and the job's workers have any.
+	GPUs *GPUs `json:"gpus,omitempty"`
+	// Cost is the estimated cost of the desired workers if
+	// Options.EstimateCost was set and their machine type is known.
+	Cost *CostEstimate `json:"estimated_cost,omitempty"`
+	// Quotas are the regional quotas the workers use, checked against their
+	// maximum number, if Options.CheckQuota was set.
+	Quotas []Quota `json:"quotas,omitempty"`
+	// Instances are the Compute Engine instances of the job's workers if
+	// Options.VerifyInstances was set.
+	Instances *Instances `json:"instances,omitempty"`
+	// OverBudget reports whether the estimated hourly cost exceeds
+	// MaxHourlyCost, the Options.MaxHourlyCost budget.
+	OverBudget    bool    `json:"over_budget,omitempty"`
+	MaxHourlyCost float64 `json:"max_hourly_cost,omitempty"`
+	// CPU is the CPU utilization of the job's workers over the window if
+	// Options.WorkerCPU was set and any worker reported one.
+	CPU *CPUUtilization `json:"cpu_utilization,omitempty"`
+	// Pools are the worker pools configured in the job's environment if
+	// Options.Pools or Options.Pool was set.
+	Pools []WorkerPool `json:"pools,omitempty"`
+	// Metrics are the job's metrics if Options.WithMetrics was set.
+	Metrics *JobMetrics `json:"metrics,omitempty"`
+	// Truncated reports that Options.MaxEvents stopped the scan before the
+	// whole window was examined.
+	Truncated bool `json:"truncated,omitempty"`
+	// Checkpoint lets a later lookup of the job resume the scan after the
+	// events found, through Options.Checkpoint.
+	Checkpoint *Checkpoint `json:"-"`
+}
+
+// Client fetches job details and messages from the Dataflow API.
+type Client struct {
+	jobs     *dataflow.JobsV1Beta3Client
+	messages *dataflow.MessagesV1Beta3Client
+	// opts create further clients when first needed, like metrics, and
+	// dataflowOpts the further Dataflow clients.
+	opts         []option.ClientOption
+	dataflowOpts []option.ClientOption
+
+	mu         sync.Mutex
+	metrics    *monitoring.MetricClient
+	jobMetrics *dataflow.MetricsV1Beta3Client
+	regions    *compute.RegionsClient
+	instances  *compute.InstancesClient
+}
+
+// NewClient creates the Dataflow Jobs and Messages clients.
+func NewClient(ctx context.Context, opts ...option.ClientOption) (*Client, error) {
+	return NewClientWithEndpoint(ctx, "", opts...)
+}
+
+// NewClientWithEndpoint is like NewClient but connects to the Dataflow API at
+// endpoint, e.g. a regional endpoint like
+// "us-central1-dataflow.googleapis.com:443" or a Private Service Connect
+// address, unless empty. Other APIs, like Cloud Monitoring, keep their
+// default endpoints.
+func NewClientWithEndpoint(ctx context.Context, endpoint string, opts ...option.ClientOption) (*Client, error) {
+	dataflowOpts := opts
+	if endpoint != "" {
+		dataflowOpts = append(slices.Clip(opts), option.WithEndpoint(endpoint))
+	}
+	jobsClient, err := dataflow.NewJobsV1Beta3Client(ctx, dataflowOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Dataflow Jobs client: %w", err)
+	}
+	messagesClient, err := dataflow.NewMessagesV1Beta3Client(ctx, dataflowOpts...)
+	if err != nil {
+		jobsClient.Close()
+		return nil, fmt.Errorf("failed to create Dataflow Messages client: %w", err)
+	}
+	return &Client{jobs: jobsClient, messages: messagesClient, opts: opts, dataflowOpts: dataflowOpts}, nil
+}
+
+// Close closes the underlying API clients.
+func (c *Client) Close() error {
+	err := errors.Join(c.jobs.Close(), c.messages.Close())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metrics != nil {
+		err = errors.Join(err, c.metrics.Close())
+	}
+	if c.jobMetrics != nil {
+		err = errors.Join(err, c.jobMetrics.Close())
+	}
+	if c.regions != nil {
+		err = errors.Join(err, c.regions.Close())
+	}
+	if c.instances != nil {
+		err = errors.Join(err, c.instances.Close())
+	}
+	return err
+}
+
+// terminalStates are the job states a job never leaves.
+var terminalStates = map[string]bool{
+	"JOB_STATE_DONE":      true,
+	"JOB_STATE_FAILED":    true,
+	"JOB_STATE_CANCELLED": true,
+	"JOB_STATE_UPDATED":   true,
+	"JOB_STATE_DRAINED":   true,
+}
+
+// IsTerminalState reports whether state, as returned by Client.JobStatus, is
+// one a job never leaves, like "JOB_STATE_DONE".
+func IsTerminalState(state string) bool {
+	return terminalStates[state]
+}
+
+// GetJob returns the job's summary, including its current state and type.
+func (c *Client) GetJob(ctx context.Context, projectID, location, jobID string) (JobSummary, error) {
+	req := &dataflowpb.GetJobRequest{
+		ProjectId: projectID,
+		Location:  location,
+		JobId:     jobID,
+	}
+	job, err := c.jobs.GetJob(ctx, req)
+	if err != nil {
+		return JobSummary{}, fmt.Errorf("API Error fetching job details: %w", err)
+	}
+	return newJobSummary(job), nil
+}
+
+// JobStatus returns the name of the job's current state, e.g. "JOB_STATE_RUNNING".
+func (c *Client) JobStatus(ctx context.Context, projectID, location, jobID string) (string, error) {
+	job, err := c.GetJob(ctx, projectID, location, jobID)
+	if err != nil {
+		return "", err
+	}
+	return job.State, nil
+}
+
+// WaitForState polls the job every waitPollInterval until it is in state,
+// e.g. "JOB_STATE_RUNNING", and returns its summary. It fails once timeout
+// elapses, when positive, or if the job reaches another terminal state first.
+func (c *Client) WaitForState(ctx context.Context, projectID, location, jobID, state string, timeout time.Duration) (JobSummary, error) {
+	want, err := ParseJobState(state)
+	if err != nil {
+		return JobSummary{}, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	last := "JOB_STATE_UNKNOWN"
+	for {
+		job, err := c.GetJob(ctx, projectID, location, jobID)
+		if err != nil && ctx.Err() == nil {
+			return JobSummary{}, err
+		}
+		if err == nil {
+			if job.State == want {
+				return job, nil
+			}
+			if IsTerminalState(job.State) {
+				return JobSummary{}, fmt.Errorf("job %s reached %s while waiting for %s", jobID, job.State, want)
+			}
+			last = job.State
+		}
+		select {
+		case <-ctx.Done():
+			return JobSummary{}, fmt.Errorf("gave up waiting for job %s to reach %s, it is %s: %w", jobID, want, last, ctx.Err())
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// Fetch determines the latest current, target and desired worker counts for
+// the job described by o.
+func (c *Client) Fetch(ctx context.Context, o Options) (*Result, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if !o.WaitStable {
+		return c.fetch(ctx, o)
+	}
+	if o.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.WaitTimeout)
+		defer cancel()
+	}
+	return c.fetchStable(ctx, o)
+}
+
+// fetchStable repeats the lookup every waitPollInterval until the current
+// workers are within o.StableTolerance of the target workers, or there is no
+// target. Jobs without events yet, e.g. right after launch, are polled again.
+func (c *Client) fetchStable(ctx context.Context, o Options) (*Result, error) {
+	var last *Result
+	for {
+		res, err := c.fetch(ctx, o)
+		switch {
+		case err == nil && res.isStable(o.StableTolerance):
+			return res, nil
+		case err == nil:
+			last = res
+		case ctx.Err() == nil && !errors.Is(err, ErrNoEvents):
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				return nil, fmt.Errorf("gave up waiting for job %s to stabilize: %w", o.Job(), ctx.Err())
+			}
+			return nil, fmt.Errorf("gave up waiting for job %s to stabilize at %d current and %d target workers: %w", last.JobID, last.CurrentWorkers, last.TargetWorkers, ctx.Err())
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
+
+// isStable reports whether the current workers are within tolerance of the
+// target workers, or no target is pending.
+func (r *Result) isStable(tolerance int64) bool {
+	if r.TargetWorkers == 0 {
+		return true
+	}
+	diff := r.CurrentWorkers - r.TargetWorkers
+	return max(diff, -diff) <= tolerance
+}
+
+// ResolveJob sets o.JobID from o.JobName or o.TemplatePath unless given,
+// and o.JobName as well when looked up by template.
+func (c *Client) ResolveJob(ctx context.Context, o *Options) error {
+	switch {
+	case o.JobID != "":
+	case o.JobName != "":
+		job, err := c.FindJobByName(ctx, o.ProjectID, o.Location, o.JobName)
+		if err != nil {
+			return err
+		}
+		o.JobID = job.ID
+	default:
+		job, err := c.FindLatestJobFromTemplate(ctx, o.ProjectID, o.Location, o.TemplatePath)
+		if err != nil {
+			return err
+		}
+		o.JobID, o.JobName = job.ID, job.Name
+	}
+	return nil
+}
+
+// fetch is Fetch without waiting for the worker counts to stabilize.
+func (c *Client) fetch(ctx context.Context, o Options) (*Result, error) {
+	if err := c.ResolveJob(ctx, &o); err != nil {
+		return nil, err
+	}
+
+	res := &Result{
+		ProjectID:  o.ProjectID,
+		Location:   o.Location,
+		JobID:      o.JobID,
+		JobName:    o.JobName,
+		JobStatus:  "N/A",
+		MinWorkers: o.MinWorker,
+		MaxWorkers: o.MaxWorker,
+	}
+	if o.WaitForState != "" {
+		job, err := c.WaitForState(ctx, o.ProjectID, o.Location, o.JobID, o.WaitForState, o.WaitTimeout)
+		if err != nil {
+			return nil, err
+		}
+		res.JobStatus, res.JobType = job.State, job.Type
+	} else if o.FetchJobStatus || o.ZeroIfTerminal || o.RequireState != "" {
+		job, err := c.GetJob(ctx, o.ProjectID, o.Location, o.JobID)
+		if err != nil {
+			return nil, err
+		}
+		res.JobStatus, res.JobType = job.State, job.Type
+	}
+	if o.RequireState != "" {
+		want, err := ParseJobState(o.RequireState)
+		if err != nil {
+			return nil, err
+		}
+		if res.JobStatus != want {
+			return nil, fmt.Errorf("%w: job %s is %s, not %s", ErrUnexpectedState, o.JobID, res.JobStatus, want)
+		}
+	}
+	if o.ZeroIfTerminal && IsTerminalState(res.JobStatus) {
+		// A finished job runs no workers, whatever its last events reported.
+		return res, nil
+	}
+
+	start, end := o.Window(time.Now().UTC())
+	scanEnd := time.Time{}
+	if !o.EndTime.IsZero() {
+		scanEnd = end
+	}
+	types, err := ParseEventTypes(o.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	t := &latestEventTracker{checkTarget: o.CheckTargetWorkers, types: types, limit: o.MaxEvents, keepEvents: o.Stat != "" || o.Trend || o.Rate || o.Histogram || o.WindowCost || o.IncludeEvents}
+	if o.SummarizeMessages {
+		t.messages = newMessageSummarizer()
+	}
+	if o.VerticalScaling {
+		t.vertical = &verticalScalingTracker{}
+	}
+	if o.Cooldown > 0 {
+		t.targetBefore = end.Add(-o.Cooldown)
+	}
+	scanStart := o.Checkpoint.resumeFrom(o, start, t)
+	if err := c.latestEvents(ctx, o, scanStart, scanEnd, t); err != nil {
+		return nil, err
+	}
+	if scanStart != start {
+		// The events before scanStart were found by the earlier lookup.
+		o.Checkpoint.fill(t, start)
+	}
+	// Stable jobs may not have scaled in a long time. Only the part of each
+	// widened window that was not scanned yet is scanned, as events found in
+	// the newer part would have ended the search.
+	for o.AutoExpandLookback && t.current == nil && t.target == nil && !t.full() {
+		lookback, ok := o.nextLookback()
+		if !ok {
+			break
+		}
+		o.Lookback, o.TimeDeltaMinutes = lookback, 0
+		scanned := start
+		start = end.Add(-lookback)
+		if err := c.latestEvents(ctx, o, start, scanned, t); err != nil {
+			return nil, err
+		}
+		res.Window = o.DescribeWindow()
+	}
+	res.Truncated = t.full()
+	res.Checkpoint = newCheckpoint(o.JobID, t, start, end)
+
+	if t.current == nil && t.target == nil {
+		if !o.MonitoringFallback && !o.JobConfigFallback {
+			return nil, fmt.Errorf("%w %s", ErrNoEvents, o.DescribeWindow())
+		}
+		if err := c.fallback(ctx, o, end, res); err != nil {
+			return nil, fmt.Errorf("%w %s, and %w", ErrNoEvents, o.DescribeWindow(), err)
+		}
+	}
+
+	if t.current != nil {
+		res.CurrentWorkers = t.current.GetCurrentNumWorkers()
+		res.CurrentEventDescription = t.current.GetDescription().GetMessageText()
+		res.LatestEventTime = t.currentTime
+	}
+	if t.target != nil {
+		res.TargetWorkers = t.target.GetTargetNumWorkers()
+		res.TargetEventDescription = t.target.GetDescription().GetMessageText()
+	}
+	if o.IgnoreDownscale && res.TargetWorkers < res.CurrentWorkers {
+		res.TargetWorkers, res.TargetEventDescription = 0, ""
+	}
+	if res.TargetWorkers > 0 && t.targetTime.After(res.LatestEventTime) {
+		res.LatestEventTime = t.targetTime
+	}
+	res.Stale = o.MaxEventAge > 0 && !res.LatestEventTime.IsZero() && end.Sub(res.LatestEventTime) > o.MaxEventAge
+	if o.Stat != "" {
+		res.Stat = o.Stat
+		if v, ok := computeStat(o.Stat, t.events, end, o.CheckTargetWorkers); ok {
+			res.StatWorkers = &v
+		}
+	}
+	if o.Trend {
+		res.Trend = workerTrend(currentSamples(t.events), res.CurrentWorkers, res.TargetWorkers, end)
+	}
+	if samples := currentSamples(t.events); o.Rate && len(samples) > 0 {
+		rate := workerSlope(samples)
+		res.WorkersPerMinute = &rate
+	}
+	if o.Histogram {
+		res.Histogram = workerHistogram(currentSamples(t.events), end)
+	}
+	if o.IncludeEvents {
+		res.Events = newEvents(t.events)
+	}
+	if t.messages != nil {
+		res.Messages = t.messages.result()
+	}
+	if t.vertical != nil {
+		res.VerticalScaling, res.MemoryPerWorkerGB = t.vertical.result()
+	}
+	if o.WatermarkAge {
+		age, _, ok, err := c.WatermarkAge(ctx, o.ProjectID, o.JobID, end)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			seconds := age.Seconds()
+			res.WatermarkAgeSeconds = &seconds
+		}
+	}
+	details := &jobDetails{c: c, projectID: o.ProjectID, location: o.Location, jobID: o.JobID}
+	if o.JobDetails {
+		job, err := details.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res.FlexRSGoal = flexRSGoal(job)
+		res.FlexRS = res.FlexRSGoal != ""
+		res.Prime = isPrime(job)
+		res.StreamingEngine = usesStreamingEngine(job)
+		res.Metadata = newJobMetadata(job)
+		res.AutoscalingOptions = autoscalingOptions(job, o.Pool)
+		if res.JobType == "" {
+			res.JobType = job.GetType().String()
+		}
+	}
+	if o.Pools || o.Pool != "" {
+		job, err := details.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if res.Pools, err = selectPools(job, o.Pool); err != nil {
+			return nil, err
+		}
+	}
+	if o.WorkerCPU {
+		if res.CPU, err = c.WorkerCPU(ctx, o.ProjectID, o.JobID, start, end); err != nil {
+			return nil, err
+		}
+	}
+	if o.WithMetrics {
+		if res.Metrics, err = c.JobMetrics(ctx, o.ProjectID, o.Location, o.JobID); err != nil {
+			return nil, err
+		}
+	}
+
+	// `DesiredWorkers` is the maximum of the latest current and target worker counts,
+	// clamped by the optional MinWorker and MaxWorker options.
+	desiredWorkers := res.CurrentWorkers
+	if res.TargetWorkers > desiredWorkers {
+		desiredWorkers = res.TargetWorkers
+	}
+	if o.MinWorker > 0 && desiredWorkers < o.MinWorker {
+		desiredWorkers = o.MinWorker
+	}
+	if o.MaxWorker > 0 && desiredWorkers > o.MaxWorker {
+		desiredWorkers = o.MaxWorker
+	}
+	res.Clamped = desiredWorkers != max(res.CurrentWorkers, res.TargetWorkers)
+	res.DesiredWorkers = desiredWorkers
+
+	if o.Resources {
+		job, err := details.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res.MachineType = workerMachineType(job, o.Pool)
+		if m, err := ParseMachineType(res.MachineType); err == nil {
+			res.Resources = &Resources{
+				MachineType:   m,
+				TotalVCPUs:    m.VCPUs * res.DesiredWorkers,
+				TotalMemoryGB: m.MemoryGB * float64(res.DesiredWorkers),
+			}
+		}
+		if gpuType, perWorker := workerGPUs(job, res.MachineType); perWorker > 0 {
+			res.GPUs = &GPUs{Type: gpuType, PerWorker: perWorker, Total: perWorker * res.DesiredWorkers}
+		}
+	}
+	if o.EstimateCost || o.WindowCost || o.MaxHourlyCost > 0 {
+		job, err := details.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		prices := o.Prices
+		if prices == nil {
+			prices = &DefaultPrices
+		}
+		res.MachineType = workerMachineType(job, o.Pool)
+		if price, err := prices.WorkerHourly(res.MachineType, job.GetType().String()); err == nil {
+			res.Cost = &CostEstimate{WorkerHourly: price, Hourly: price * float64(res.DesiredWorkers)}
+			if o.WindowCost {
+				hours, covered := workerHours(currentSamples(t.events), end)
+				res.Cost.Window = &WindowCost{
+					WorkerHours:    hours,
+					Cost:           hours * price,
+					CoveredSeconds: covered.Seconds(),
+					WindowSeconds:  end.Sub(start).Seconds(),
+				}
+			}
+		}
+		res.MaxHourlyCost = o.MaxHourlyCost
+		res.OverBudget = o.MaxHourlyCost > 0 && res.Cost != nil && res.Cost.Hourly > o.MaxHourlyCost
+	}
+	if o.CheckQuota {
+		job, err := details.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if res.Quotas, err = c.checkQuota(ctx, o.ProjectID, o.Location, job, o.Pool, o.MaxWorker, res.CurrentWorkers); err != nil {
+			return nil, err
+		}
+	}
+	if o.VerifyInstances {
+		if res.Instances, err = c.WorkerInstances(ctx, o.ProjectID, o.JobID); err != nil {
+			return nil, err
+		}
+		res.Instances.Diverged = res.Instances.Running != res.CurrentWorkers
+	}
+
+	return res, nil
+}
+
+// fallback sets the current workers of res from Cloud Monitoring or else the
+// job's configuration, as enabled by o, when no autoscaling events exist.
+func (c *Client) fallback(ctx context.Context, o Options, end time.Time, res *Result) error {
+	var errs []error
+	if o.MonitoringFallback {
+		workers, at, err := c.MonitoredWorkers(ctx, o.ProjectID, o.JobID, end)
+		if err == nil {
+			res.CurrentWorkers, res.LatestEventTime, res.Source = workers, at, SourceMonitoring
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("falling back to Cloud Monitoring failed: %w", err))
+	}
+	if o.JobConfigFallback {
+		workers, err := c.ConfiguredWorkers(ctx, o.ProjectID, o.Location, o.JobID, o.Pool)
+		if err == nil {
+			res.CurrentWorkers, res.Source = workers, SourceJobConfig
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("falling back to the job's configuration failed: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// latestEvents observes the autoscaling events between start and end with t.
+// A zero end leaves the window open.
+//
+// The window is scanned newest first in slices doubling from firstScanSlice,
+// stopping once the events needed were found: no older event can replace
+// them, so long lookbacks on busy jobs need not be paged through entirely.
+// Statistics and message summaries over the window need every event and
+// message, so such trackers scan the whole window.
+func (c *Client) latestEvents(ctx context.Context, o Options, start, end time.Time, t *latestEventTracker) error {
+	top, slice := end, firstScanSlice
+	bottom := end
+	if bottom.IsZero() {
+		bottom = time.Now().UTC()
+	}
+	for {
+		bottom = bottom.Add(-slice)
+		if bottom.Before(start) {
+			bottom = start
+		}
+		if err := c.scanMessages(ctx, o, bottom, top, t); err != nil {
+			return err
+		}
+		if !bottom.After(start) || t.full() || (!t.wholeWindow() && t.current != nil && (t.target != nil || !o.CheckTargetWorkers)) {
+			return nil
+		}
+		top, slice = bottom, 2*slice
+	}
+}
+
+// scanMessages observes the autoscaling events in the job messages between
+// start and end with t. A zero end leaves the window open.
+func (c *Client) scanMessages(ctx context.Context, o Options, start, end time.Time, t *latestEventTracker) error {
+	importance, err := ParseImportance(o.MinImportance)
+	if err != nil {
+		return err
+	}
+	req := &dataflowpb.ListJobMessagesRequest{
+		ProjectId:         o.ProjectID,
+		Location:          o.Location,
+		JobId:             o.JobID,
+		MinimumImportance: importance,
+		PageSize:          o.PageSize,
+		StartTime:         timestamppb.New(start),
+	}
+	if !end.IsZero() {
+		req.EndTime = timestamppb.New(end)
+	}
+
+	if err := scanEvents(newMessagePager(c.messagePage(ctx), req), t); err != nil {
+		return fmt.Errorf("API Error fetching job messages: %w", err)
+	}
+	return nil
+}